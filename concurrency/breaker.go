@@ -0,0 +1,249 @@
+package concurrency
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of calling through an open breaker, or a
+// half-open one that already has enough probes in flight.
+var ErrCircuitOpen = fmt.Errorf("Circuit breaker is open.")
+
+type BreakerState int
+
+const (
+	// StateClosed lets every call through.
+	StateClosed BreakerState = iota
+	// StateOpen fails every call right away.
+	StateOpen
+	// StateHalfOpen lets a few probe calls through to test the downstream.
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerCounts holds the outcomes seen since the breaker last changed state,
+// or since the start of the current Window when closed.
+type BreakerCounts struct {
+	Requests             int
+	Successes            int
+	Failures             int
+	ConsecutiveSuccesses int
+	ConsecutiveFailures  int
+}
+
+// TripPolicy decides from the counts of a closed breaker whether it opens.
+type TripPolicy func(counts BreakerCounts) bool
+
+// TripAfterFailures opens the breaker after n failures in a row.
+func TripAfterFailures(n int) TripPolicy {
+	return func(c BreakerCounts) bool {
+		return c.ConsecutiveFailures >= n
+	}
+}
+
+// TripOnFailureRatio opens the breaker when at least ratio of the requests
+// failed, once minRequests have been seen.
+func TripOnFailureRatio(ratio float64, minRequests int) TripPolicy {
+	return func(c BreakerCounts) bool {
+		return c.Requests >= minRequests && float64(c.Failures) >= ratio*float64(c.Requests)
+	}
+}
+
+// BreakerConfig configures a CircuitBreaker. Trip defaults to
+// TripAfterFailures(5). A closed breaker resets its counts every Window, or
+// never when Window is zero. An open breaker turns half-open after
+// OpenTimeout, 60 seconds by default, and lets HalfOpenRequests probes
+// through, 1 by default; it closes once they all succeed and opens again on
+// the first failure. IsFailure tells failed calls apart; when nil, callers
+// wrapping the breaker apply their own rule, and Execute counts any non-nil
+// error. OnStateChange is called with the breaker locked, so it must
+// not call back into the breaker.
+type BreakerConfig struct {
+	Trip             TripPolicy
+	Window           time.Duration
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	IsFailure        func(err error) bool
+	OnStateChange    func(name string, from, to BreakerState)
+	Clock            Clock
+}
+
+func (c *BreakerConfig) normalize() {
+	if c.Trip == nil {
+		c.Trip = TripAfterFailures(5)
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 60 * time.Second
+	}
+	if c.HalfOpenRequests < 1 {
+		c.HalfOpenRequests = 1
+	}
+	if c.Clock == nil {
+		c.Clock = SystemClock
+	}
+}
+
+// CircuitBreaker stops calling a downstream which keeps failing, giving it
+// time to recover instead of piling up calls waiting on timeouts.
+type CircuitBreaker struct {
+	name   string
+	conf   BreakerConfig
+	mutex  *sync.Mutex
+	state  BreakerState
+	counts BreakerCounts
+	// generation changes with every state change or window reset, so that
+	// outcomes of calls started before are ignored.
+	generation uint64
+	expiry     time.Time
+}
+
+func NewCircuitBreaker(name string, conf BreakerConfig) *CircuitBreaker {
+	conf.normalize()
+	b := &CircuitBreaker{
+		name:  name,
+		conf:  conf,
+		mutex: &sync.Mutex{},
+	}
+	b.reset(conf.Clock.Now())
+	return b
+}
+
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+func (b *CircuitBreaker) State() BreakerState {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.current(b.conf.Clock.Now())
+}
+
+func (b *CircuitBreaker) Counts() BreakerCounts {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.current(b.conf.Clock.Now())
+	return b.counts
+}
+
+// Allow asks to make a call. Unless it returns ErrCircuitOpen, done must be
+// called once with the outcome of the call.
+func (b *CircuitBreaker) Allow() (done func(failed bool), err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	switch b.current(b.conf.Clock.Now()) {
+	case StateOpen:
+		return nil, ErrCircuitOpen
+	case StateHalfOpen:
+		if b.counts.Requests >= b.conf.HalfOpenRequests {
+			return nil, ErrCircuitOpen
+		}
+	}
+	b.counts.Requests++
+	generation := b.generation
+	return func(failed bool) {
+		b.done(generation, failed)
+	}, nil
+}
+
+// Execute calls f unless the breaker is open. A panic in f counts as a
+// failure and is propagated.
+func (b *CircuitBreaker) Execute(f func() error) (err error) {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	failed := true
+	defer func() {
+		done(failed)
+	}()
+	err = f()
+	failed = b.IsFailure(err, nil)
+	return err
+}
+
+// IsFailure reports whether a call ending with err failed, by the configured
+// IsFailure, or else by rule, or else whether err is non-nil.
+func (b *CircuitBreaker) IsFailure(err error, rule func(err error) bool) bool {
+	if b.conf.IsFailure != nil {
+		return b.conf.IsFailure(err)
+	}
+	if rule != nil {
+		return rule(err)
+	}
+	return err != nil
+}
+
+func (b *CircuitBreaker) done(generation uint64, failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.conf.Clock.Now()
+	state := b.current(now)
+	if generation != b.generation {
+		return
+	}
+	if failed {
+		b.counts.Failures++
+		b.counts.ConsecutiveFailures++
+		b.counts.ConsecutiveSuccesses = 0
+		if state == StateHalfOpen || b.conf.Trip(b.counts) {
+			b.setState(StateOpen, now)
+		}
+		return
+	}
+	b.counts.Successes++
+	b.counts.ConsecutiveSuccesses++
+	b.counts.ConsecutiveFailures = 0
+	if state == StateHalfOpen && b.counts.ConsecutiveSuccesses >= b.conf.HalfOpenRequests {
+		b.setState(StateClosed, now)
+	}
+}
+
+// current moves the breaker along with time: an open breaker turns half-open
+// after OpenTimeout and a closed one starts a new window.
+func (b *CircuitBreaker) current(now time.Time) BreakerState {
+	if b.expiry.IsZero() || now.Before(b.expiry) {
+		return b.state
+	}
+	switch b.state {
+	case StateOpen:
+		b.setState(StateHalfOpen, now)
+	case StateClosed:
+		b.reset(now)
+	}
+	return b.state
+}
+
+func (b *CircuitBreaker) setState(state BreakerState, now time.Time) {
+	from := b.state
+	b.state = state
+	b.reset(now)
+	if b.conf.OnStateChange != nil {
+		b.conf.OnStateChange(b.name, from, state)
+	}
+}
+
+func (b *CircuitBreaker) reset(now time.Time) {
+	b.generation++
+	b.counts = BreakerCounts{}
+	b.expiry = time.Time{}
+	switch b.state {
+	case StateClosed:
+		if b.conf.Window > 0 {
+			b.expiry = now.Add(b.conf.Window)
+		}
+	case StateOpen:
+		b.expiry = now.Add(b.conf.OpenTimeout)
+	}
+}
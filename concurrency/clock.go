@@ -0,0 +1,91 @@
+package concurrency
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so schedules can be driven by tests.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type manualWaiter struct {
+	at time.Time
+	c  chan time.Time
+}
+
+// ManualClock is a Clock that only moves when Advance is called.
+type ManualClock struct {
+	mutex   *sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []manualWaiter
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	mutex := &sync.Mutex{}
+	return &ManualClock{
+		mutex: mutex,
+		cond:  sync.NewCond(mutex),
+		now:   now,
+	}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) After(d time.Duration) <-chan time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, manualWaiter{at: c.now.Add(d), c: ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+// Advance moves the clock forward by d, firing every After that is due.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = waiters
+}
+
+// BlockUntil waits until at least n calls to After are pending.
+func (c *ManualClock) BlockUntil(n int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,122 @@
+package concurrency
+
+import (
+	"fmt"
+	"time"
+)
+
+// ElasticConfig lets a WorkersPool grow and shrink between MinWorkers and
+// MaxWorkers. A worker is added when more than QueueThreshold works are queued
+// or a work waited longer than WaitThreshold before being picked up; a zero
+// threshold disables that trigger. Workers idle for longer than KeepAlive are
+// retired down to MinWorkers.
+type ElasticConfig struct {
+	MinWorkers     int
+	MaxWorkers     int
+	QueueThreshold int
+	WaitThreshold  time.Duration
+	KeepAlive      time.Duration
+}
+
+func (c *ElasticConfig) normalize() {
+	if c.MinWorkers < 1 {
+		c.MinWorkers = 1
+	}
+	if c.MaxWorkers < c.MinWorkers {
+		c.MaxWorkers = c.MinWorkers
+	}
+}
+
+func (c *ElasticConfig) clamp(n int) int {
+	if n < c.MinWorkers {
+		return c.MinWorkers
+	}
+	if n > c.MaxWorkers {
+		return c.MaxWorkers
+	}
+	return n
+}
+
+// keepAlive returns a channel firing once an idle worker may be retired, or
+// nil when the pool never shrinks.
+func (wp *WorkersPool) keepAlive() (<-chan time.Time, func() bool) {
+	if wp.Elastic == nil || wp.Elastic.KeepAlive <= 0 {
+		return nil, func() bool { return false }
+	}
+	timer := time.NewTimer(wp.Elastic.KeepAlive)
+	return timer.C, timer.Stop
+}
+
+// maybeGrow adds a worker when the queue is backing up. waited is how long
+// the work just picked up spent in the queue.
+func (wp *WorkersPool) maybeGrow(waited time.Duration) {
+	cfg := wp.Elastic
+	if cfg == nil {
+		return
+	}
+	deep := cfg.QueueThreshold > 0 && wp.workQ.len() > cfg.QueueThreshold
+	slow := cfg.WaitThreshold > 0 && waited > cfg.WaitThreshold
+	if !deep && !slow {
+		return
+	}
+
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	// Count the workers still finishing a work after being stopped too.
+	if wp.isStopped() || wp.live >= cfg.MaxWorkers {
+		return
+	}
+	wp.addWorker()
+}
+
+// retire removes an idle worker from the pool unless it is already at its
+// minimum size. A worker that is no longer registered has been stopped and
+// waits for its Quit signal instead.
+func (wp *WorkersPool) retire(w *Worker) bool {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	if wp.Len() <= wp.Elastic.MinWorkers {
+		return false
+	}
+	found := false
+	for i, n := 0, wp.Len(); i < n; i++ {
+		if worker := wp.Pop().(*Worker); worker != w {
+			wp.Push(worker)
+		} else {
+			found = true
+		}
+	}
+	return found
+}
+
+// Resize sets the number of workers. Extra workers finish their current work,
+// if any, and take no other before quitting. In elastic mode n has to lie within MinWorkers and
+// MaxWorkers, and the pool keeps scaling from there.
+func (wp *WorkersPool) Resize(n int) error {
+	if n < 1 {
+		return fmt.Errorf("WorkersPool needs at least one worker.")
+	}
+	if cfg := wp.Elastic; cfg != nil && (n < cfg.MinWorkers || n > cfg.MaxWorkers) {
+		return fmt.Errorf("Worker count %d is outside [%d, %d].", n, cfg.MinWorkers, cfg.MaxWorkers)
+	}
+
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	if wp.isStopped() {
+		return fmt.Errorf("WorkersPool is stopped.")
+	}
+	for wp.Len() < n {
+		wp.addWorker()
+	}
+	for wp.Len() > n {
+		wp.Pop().(*Worker).Stop()
+	}
+	return nil
+}
+
+// Workers returns the current number of workers.
+func (wp *WorkersPool) Workers() int {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	return wp.Len()
+}
@@ -0,0 +1,139 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned when a job panics. Stack holds the goroutine stack
+// captured at the point of the panic. JobID, WorkerID and Params, the params
+// the job was submitted with, are only set for panics of pool jobs.
+type PanicError struct {
+	JobID    uint64
+	WorkerID int
+	Params   interface{}
+	Value    interface{}
+	Stack    []byte
+}
+
+func (e *PanicError) Error() string {
+	if e.JobID != 0 {
+		return fmt.Sprintf("job %d panic on worker %d: %v\n%s", e.JobID, e.WorkerID, e.Value, e.Stack)
+	}
+	return fmt.Sprintf("job panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Future is a handle to the result of a job submitted with Submit.
+type Future[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{
+		done: make(chan struct{}),
+	}
+}
+
+func (f *Future[T]) resolve(result T, err error) {
+	f.result, f.err = result, err
+	close(f.done)
+}
+
+// Done is closed once the job has finished, failed or been cancelled.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the job has finished or ctx is done.
+func (f *Future[T]) Wait(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Submit queues f on the pool and returns a Future for its result; RunAt and
+// RunAfter can postpone it. A panic
+// inside f is recovered and reported by the Future as a *PanicError. If ctx is
+// done before a worker picks the job up, the Future resolves with ctx.Err().
+func Submit[T any](wp *WorkersPool, ctx context.Context, f func(context.Context) (T, error), opts ...SubmitOption) (*Future[T], error) {
+	future := newFuture[T]()
+	_, err := wp.submit(WorkRequest{
+		ctx: ctx,
+		f: func(interface{}) interface{} {
+			result, err := callJob(ctx, f)
+			future.resolve(result, err)
+			return err
+		},
+		errResult: true,
+		cancelled: func(err error) {
+			var zero T
+			future.resolve(zero, err)
+		},
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return future, nil
+}
+
+func callJob[T any](ctx context.Context, f func(context.Context) (T, error)) (result T, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	return f(ctx)
+}
+
+// WaitAll waits for every future and returns their results in order. It stops
+// at the first error, returning the results collected so far.
+func WaitAll[T any](ctx context.Context, futures ...*Future[T]) ([]T, error) {
+	results := make([]T, 0, len(futures))
+	for _, f := range futures {
+		r, err := f.Wait(ctx)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// WaitAny waits for the first future to finish and returns its index along
+// with its result.
+func WaitAny[T any](ctx context.Context, futures ...*Future[T]) (int, T, error) {
+	var zero T
+	if len(futures) == 0 {
+		return -1, zero, fmt.Errorf("WaitAny needs at least one future.")
+	}
+
+	first := make(chan int, len(futures))
+	stop := make(chan struct{})
+	defer close(stop)
+	for i, f := range futures {
+		go func(i int, f *Future[T]) {
+			select {
+			case <-f.done:
+				first <- i
+			case <-stop:
+			}
+		}(i, f)
+	}
+
+	select {
+	case i := <-first:
+		return i, futures[i].result, futures[i].err
+	case <-ctx.Done():
+		return -1, zero, ctx.Err()
+	}
+}
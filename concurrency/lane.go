@@ -0,0 +1,56 @@
+package concurrency
+
+import (
+	"github.com/heqzha/goutils/container"
+)
+
+// DefaultLane is the lane used by submissions that do not name one.
+const DefaultLane = "default"
+
+// Lane describes one submission queue of a WorkersPool. Workers share their
+// time between non-empty lanes in proportion to Weight, so a lane with weight 4
+// gets four jobs dispatched for every one of a lane with weight 1. MaxDepth
+// caps how many works may wait on the lane.
+type Lane struct {
+	Name     string
+	Weight   int
+	MaxDepth int
+}
+
+type workLane struct {
+	Lane
+	q       container.Deque[WorkRequest]
+	current int
+}
+
+// selectLane picks the next lane to dispatch from using smooth weighted
+// round-robin over the non-empty lanes, or nil when every lane is empty.
+func selectLane(lanes []*workLane) *workLane {
+	var best *workLane
+	total := 0
+	for _, l := range lanes {
+		if l.q.Len() == 0 {
+			l.current = 0
+			continue
+		}
+		l.current += l.Weight
+		total += l.Weight
+		if best == nil || l.current > best.current {
+			best = l
+		}
+	}
+	if best != nil {
+		best.current -= total
+	}
+	return best
+}
+
+// SubmitOption customises a single submission.
+type SubmitOption func(*WorkRequest)
+
+// OnLane submits the work to the named lane.
+func OnLane(name string) SubmitOption {
+	return func(w *WorkRequest) {
+		w.lane = name
+	}
+}
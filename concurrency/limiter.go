@@ -0,0 +1,296 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limiter throttles events. Allow takes a slot only if one is free right now,
+// Reserve takes the next free slot and tells how long to wait for it, and Wait
+// blocks until a slot is free or ctx is done.
+type Limiter interface {
+	Allow() bool
+	Reserve() *Reservation
+	Wait(ctx context.Context) error
+}
+
+// Reservation is a slot taken from a Limiter.
+type Reservation struct {
+	ok     bool
+	delay  time.Duration
+	cancel func()
+}
+
+// OK reports whether the limiter could grant the slot at all.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay is how long to wait before acting on the reservation.
+func (r *Reservation) Delay() time.Duration {
+	return r.delay
+}
+
+// Cancel gives the slot back so that others may use it.
+func (r *Reservation) Cancel() {
+	if r.ok && r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+}
+
+var errLimitExceeded = fmt.Errorf("Rate limit cannot be satisfied.")
+
+func waitReservation(ctx context.Context, clock Clock, r *Reservation) error {
+	if !r.OK() {
+		return errLimitExceeded
+	}
+	if r.Delay() <= 0 {
+		return nil
+	}
+	select {
+	case <-clock.After(r.Delay()):
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
+
+// TokenBucket refills rate tokens per second up to burst, each event taking
+// one token.
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	clock  Clock
+	mutex  *sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket. clock may be nil for SystemClock.
+func NewTokenBucket(rate float64, burst int, clock Clock) *TokenBucket {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		clock:  clock,
+		mutex:  &sync.Mutex{},
+		tokens: float64(burst),
+		last:   clock.Now(),
+	}
+}
+
+func (b *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
+
+func (b *TokenBucket) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill(b.clock.Now())
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (b *TokenBucket) Reserve() *Reservation {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.burst < 1 || b.rate <= 0 {
+		return &Reservation{}
+	}
+	b.refill(b.clock.Now())
+	b.tokens--
+	delay := time.Duration(0)
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return &Reservation{
+		ok:    true,
+		delay: delay,
+		cancel: func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			b.refill(b.clock.Now())
+			b.tokens++
+			if b.tokens > b.burst {
+				b.tokens = b.burst
+			}
+		},
+	}
+}
+
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	return waitReservation(ctx, b.clock, b.Reserve())
+}
+
+// LeakyBucket lets events through at a steady rate per second, queueing at
+// most capacity of them; events that would overflow the queue are refused.
+type LeakyBucket struct {
+	interval time.Duration
+	capacity int
+	clock    Clock
+	mutex    *sync.Mutex
+	next     time.Time
+}
+
+// NewLeakyBucket returns an empty bucket. clock may be nil for SystemClock.
+// It panics if rate is not positive.
+func NewLeakyBucket(rate float64, capacity int, clock Clock) *LeakyBucket {
+	if rate <= 0 {
+		panic("concurrency: LeakyBucket rate must be positive")
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &LeakyBucket{
+		interval: time.Duration(float64(time.Second) / rate),
+		capacity: capacity,
+		clock:    clock,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+func (b *LeakyBucket) Allow() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// A rate too high for the clock leaves no interval, which Reserve and
+	// Wait refuse as well.
+	if b.interval <= 0 {
+		return false
+	}
+	now := b.clock.Now()
+	if b.next.After(now) {
+		return false
+	}
+	b.next = now.Add(b.interval)
+	return true
+}
+
+func (b *LeakyBucket) Reserve() *Reservation {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.interval <= 0 {
+		return &Reservation{}
+	}
+	now := b.clock.Now()
+	slot := now
+	if b.next.After(now) {
+		slot = b.next
+	}
+	delay := slot.Sub(now)
+	if int(delay/b.interval) > b.capacity {
+		return &Reservation{}
+	}
+	b.next = slot.Add(b.interval)
+	return &Reservation{
+		ok:    true,
+		delay: delay,
+		cancel: func() {
+			b.mutex.Lock()
+			defer b.mutex.Unlock()
+			b.next = b.next.Add(-b.interval)
+		},
+	}
+}
+
+func (b *LeakyBucket) Wait(ctx context.Context) error {
+	return waitReservation(ctx, b.clock, b.Reserve())
+}
+
+// SlidingWindow allows at most limit events within any window long period.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	clock  Clock
+	mutex  *sync.Mutex
+	// events holds the times of the events in the current window, in order.
+	// Reserved slots may lie in the future.
+	events []time.Time
+}
+
+// NewSlidingWindow returns an empty window. clock may be nil for SystemClock.
+func NewSlidingWindow(limit int, window time.Duration, clock Clock) *SlidingWindow {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		clock:  clock,
+		mutex:  &sync.Mutex{},
+	}
+}
+
+func (w *SlidingWindow) prune(now time.Time) {
+	i := 0
+	for i < len(w.events) && !w.events[i].After(now.Add(-w.window)) {
+		i++
+	}
+	w.events = w.events[i:]
+}
+
+func (w *SlidingWindow) Allow() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	now := w.clock.Now()
+	w.prune(now)
+	if len(w.events) >= w.limit {
+		return false
+	}
+	// Reserved slots may lie after now, keep the events in order.
+	i := sort.Search(len(w.events), func(i int) bool {
+		return w.events[i].After(now)
+	})
+	w.events = append(w.events, time.Time{})
+	copy(w.events[i+1:], w.events[i:])
+	w.events[i] = now
+	return true
+}
+
+func (w *SlidingWindow) Reserve() *Reservation {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.limit <= 0 {
+		return &Reservation{}
+	}
+	now := w.clock.Now()
+	w.prune(now)
+	slot := now
+	if n := len(w.events); n >= w.limit {
+		slot = w.events[n-w.limit].Add(w.window)
+	}
+	w.events = append(w.events, slot)
+	return &Reservation{
+		ok:    true,
+		delay: slot.Sub(now),
+		cancel: func() {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+			for i := len(w.events) - 1; i >= 0; i-- {
+				if w.events[i].Equal(slot) {
+					w.events = append(w.events[:i], w.events[i+1:]...)
+					return
+				}
+			}
+		},
+	}
+}
+
+func (w *SlidingWindow) Wait(ctx context.Context) error {
+	return waitReservation(ctx, w.clock, w.Reserve())
+}
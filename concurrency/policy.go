@@ -0,0 +1,42 @@
+package concurrency
+
+import (
+	"fmt"
+	"time"
+)
+
+// SubmitPolicy decides what a submission does when its lane is full.
+type SubmitPolicy int
+
+const (
+	// PolicyReject fails the submission with ErrWorkQueueFull.
+	PolicyReject SubmitPolicy = iota
+	// PolicyBlock waits for space until the submission context is done or,
+	// if set with WithBlockTimeout, the timeout expires.
+	PolicyBlock
+	// PolicyDropOldest evicts the oldest work of the lane, which is cancelled
+	// with ErrWorkDropped, to make room for the new one.
+	PolicyDropOldest
+	// PolicyCallerRuns runs the work in the submitting goroutine.
+	PolicyCallerRuns
+)
+
+var (
+	ErrWorkQueueFull = fmt.Errorf("WorkQueue is full, cannot add more works.")
+	ErrWorkDropped   = fmt.Errorf("Work was dropped to make room for a newer one.")
+)
+
+// WithPolicy overrides the pool's Policy for a single submission.
+func WithPolicy(p SubmitPolicy) SubmitOption {
+	return func(w *WorkRequest) {
+		w.policy = p
+	}
+}
+
+// WithBlockTimeout blocks for at most d waiting for space in the lane.
+func WithBlockTimeout(d time.Duration) SubmitOption {
+	return func(w *WorkRequest) {
+		w.policy = PolicyBlock
+		w.timeout = d
+	}
+}
@@ -0,0 +1,234 @@
+package concurrency
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrWorkUnscheduled = fmt.Errorf("Scheduled work was cancelled before it was due.")
+
+// RunAt holds the work back until t. It occupies no worker while waiting.
+func RunAt(t time.Time) SubmitOption {
+	return func(w *WorkRequest) {
+		w.at = t
+	}
+}
+
+// RunAfter holds the work back for d. It occupies no worker while waiting.
+func RunAfter(d time.Duration) SubmitOption {
+	return func(w *WorkRequest) {
+		if d > 0 {
+			w.at = time.Now().Add(d)
+		}
+	}
+}
+
+// ScheduledWork is a handle to a work waiting for its due time.
+type ScheduledWork struct {
+	work  WorkRequest
+	index int
+	sched *timedQueue
+}
+
+// At returns when the work is due, or when it was queued for work that was
+// already due when submitted.
+func (s *ScheduledWork) At() time.Time {
+	return s.work.at
+}
+
+// Cancel removes the work from the schedule. It returns false when the work
+// is already due or cancelled.
+func (s *ScheduledWork) Cancel() bool {
+	return s.sched.remove(s, ErrWorkUnscheduled)
+}
+
+type scheduledHeap []*ScheduledWork
+
+func (h scheduledHeap) Len() int { return len(h) }
+
+func (h scheduledHeap) Less(i, j int) bool {
+	if h[i].work.at.Equal(h[j].work.at) {
+		return h[i].work.id < h[j].work.id
+	}
+	return h[i].work.at.Before(h[j].work.at)
+}
+
+func (h scheduledHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduledHeap) Push(x interface{}) {
+	s := x.(*ScheduledWork)
+	s.index = len(*h)
+	*h = append(*h, s)
+}
+
+func (h *scheduledHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	s.index = -1
+	*h = old[:n-1]
+	return s
+}
+
+// timedQueue keeps delayed works in a timer heap and hands them to the pool
+// once they are due.
+type timedQueue struct {
+	pool  *WorkersPool
+	mutex *sync.Mutex
+	items scheduledHeap
+	wake  chan struct{}
+	quit  chan struct{}
+	// stopped is set by stop, after which added works are cancelled.
+	stopped bool
+}
+
+func newTimedQueue(pool *WorkersPool) *timedQueue {
+	s := &timedQueue{
+		pool:  pool,
+		mutex: &sync.Mutex{},
+		wake:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *timedQueue) add(work WorkRequest) *ScheduledWork {
+	sw := &ScheduledWork{
+		work:  work,
+		index: -1,
+		sched: s,
+	}
+	s.mutex.Lock()
+	if s.stopped {
+		s.mutex.Unlock()
+		s.pool.skip(work, fmt.Errorf("WorkersPool is stopped."))
+		return sw
+	}
+	heap.Push(&s.items, sw)
+	first := sw.index == 0
+	s.mutex.Unlock()
+	if first {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return sw
+}
+
+func (s *timedQueue) remove(sw *ScheduledWork, err error) bool {
+	s.mutex.Lock()
+	if sw.index < 0 {
+		s.mutex.Unlock()
+		return false
+	}
+	heap.Remove(&s.items, sw.index)
+	s.mutex.Unlock()
+	s.pool.skip(sw.work, err)
+	return true
+}
+
+// cancelAll drops every work still waiting for its due time.
+func (s *timedQueue) cancelAll(err error) {
+	s.mutex.Lock()
+	items := s.items
+	s.items = nil
+	for _, sw := range items {
+		sw.index = -1
+	}
+	s.mutex.Unlock()
+	for _, sw := range items {
+		s.pool.skip(sw.work, err)
+	}
+}
+
+func (s *timedQueue) stop() {
+	s.mutex.Lock()
+	s.stopped = true
+	s.mutex.Unlock()
+	close(s.quit)
+	s.cancelAll(fmt.Errorf("WorkersPool is stopped."))
+}
+
+func (s *timedQueue) run() {
+	for {
+		s.mutex.Lock()
+		now := time.Now()
+		due := []WorkRequest{}
+		for s.items.Len() > 0 && !s.items[0].work.at.After(now) {
+			due = append(due, heap.Pop(&s.items).(*ScheduledWork).work)
+		}
+		var timer *time.Timer
+		var next <-chan time.Time
+		if s.items.Len() > 0 {
+			timer = time.NewTimer(s.items[0].work.at.Sub(now))
+			next = timer.C
+		}
+		s.mutex.Unlock()
+
+		for _, work := range due {
+			s.fire(work)
+		}
+
+		select {
+		case <-next:
+		case <-s.wake:
+		case <-s.quit:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-s.quit:
+			return
+		default:
+		}
+	}
+}
+
+// fire queues a due work, or cancels it once the pool is stopped. Works that
+// may block or run in the caller get their own goroutine so they cannot hold
+// up the rest of the schedule.
+func (s *timedQueue) fire(work WorkRequest) {
+	enqueue := func() {
+		if s.pool.isStopped() {
+			s.pool.skip(work, fmt.Errorf("WorkersPool is stopped."))
+			return
+		}
+		if err := s.pool.enqueue(work); err != nil {
+			s.pool.skip(work, err)
+		}
+	}
+	if work.policy == PolicyBlock || work.policy == PolicyCallerRuns {
+		go enqueue()
+	} else {
+		enqueue()
+	}
+}
+
+// ScheduleAt queues f to run at t and returns a handle that can cancel it
+// until then. A t that is not in the future queues f right away, and the
+// handle's Cancel returns false. output may be nil.
+func (wp *WorkersPool) ScheduleAt(ctx context.Context, t time.Time, f func(interface{}) interface{}, params interface{}, output chan interface{}, opts ...SubmitOption) (*ScheduledWork, error) {
+	work := WorkRequest{
+		ctx:    ctx,
+		f:      f,
+		params: params,
+		output: output,
+	}
+	return wp.submit(work, append(opts, RunAt(t))...)
+}
+
+// ScheduleAfter queues f to run once d has elapsed, like ScheduleAt.
+func (wp *WorkersPool) ScheduleAfter(ctx context.Context, d time.Duration, f func(interface{}) interface{}, params interface{}, output chan interface{}, opts ...SubmitOption) (*ScheduledWork, error) {
+	return wp.ScheduleAt(ctx, time.Now().Add(d), f, params, output, opts...)
+}
@@ -0,0 +1,112 @@
+package concurrency
+
+import (
+	"runtime/debug"
+	"sync"
+)
+
+// SingleflightResult is what DoChan delivers. Shared tells whether the result
+// was handed to more than one caller.
+type SingleflightResult[T any] struct {
+	Val    T
+	Err    error
+	Shared bool
+}
+
+type flight[T any] struct {
+	done    chan struct{}
+	val     T
+	err     error
+	dups    int
+	waiters []chan SingleflightResult[T]
+}
+
+// Singleflight runs a function at most once at a time per key, handing its
+// result to every caller asking for the same key meanwhile.
+type Singleflight[T any] struct {
+	mutex   *sync.Mutex
+	flights map[string]*flight[T]
+}
+
+func NewSingleflight[T any]() *Singleflight[T] {
+	return &Singleflight[T]{
+		mutex:   &sync.Mutex{},
+		flights: make(map[string]*flight[T]),
+	}
+}
+
+// Do calls fn unless a call for key is already in flight, in which case it
+// waits for that call and returns its result. A panic in fn is returned to
+// every caller as a *PanicError.
+func (g *Singleflight[T]) Do(key string, fn func() (T, error)) (v T, err error, shared bool) {
+	g.mutex.Lock()
+	if f, ok := g.flights[key]; ok {
+		f.dups++
+		g.mutex.Unlock()
+		<-f.done
+		return f.val, f.err, true
+	}
+	f := g.start(key)
+	g.mutex.Unlock()
+
+	g.run(key, f, fn)
+	return f.val, f.err, f.dups > 0
+}
+
+// DoChan is Do delivering the result on a channel instead of blocking.
+func (g *Singleflight[T]) DoChan(key string, fn func() (T, error)) <-chan SingleflightResult[T] {
+	ch := make(chan SingleflightResult[T], 1)
+	g.mutex.Lock()
+	if f, ok := g.flights[key]; ok {
+		f.dups++
+		f.waiters = append(f.waiters, ch)
+		g.mutex.Unlock()
+		return ch
+	}
+	f := g.start(key)
+	f.waiters = append(f.waiters, ch)
+	g.mutex.Unlock()
+
+	go g.run(key, f, fn)
+	return ch
+}
+
+// Forget makes the next call for key run fn again instead of waiting for the
+// call in flight.
+func (g *Singleflight[T]) Forget(key string) {
+	g.mutex.Lock()
+	delete(g.flights, key)
+	g.mutex.Unlock()
+}
+
+func (g *Singleflight[T]) start(key string) *flight[T] {
+	f := &flight[T]{
+		done: make(chan struct{}),
+	}
+	g.flights[key] = f
+	return f
+}
+
+func (g *Singleflight[T]) run(key string, f *flight[T], fn func() (T, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.err = &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+		g.mutex.Lock()
+		if g.flights[key] == f {
+			delete(g.flights, key)
+		}
+		shared := f.dups > 0
+		waiters := f.waiters
+		g.mutex.Unlock()
+
+		close(f.done)
+		for _, ch := range waiters {
+			ch <- SingleflightResult[T]{Val: f.val, Err: f.err, Shared: shared}
+		}
+	}()
+	f.val, f.err = fn()
+}
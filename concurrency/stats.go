@@ -0,0 +1,156 @@
+package concurrency
+
+import (
+	"time"
+)
+
+// HistogramBounds are the upper bounds of the buckets used for the queue wait
+// and run time histograms of a WorkersPool.
+var HistogramBounds = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram counts durations into buckets. Counts[i] holds the observations
+// not greater than Bounds[i]; the last entry of Counts holds everything above
+// the last bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []int64
+	Count  int64
+	Sum    time.Duration
+}
+
+func newHistogram() Histogram {
+	return Histogram{
+		Bounds: HistogramBounds,
+		Counts: make([]int64, len(HistogramBounds)+1),
+	}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.Bounds) && d > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+func (h *Histogram) copy() Histogram {
+	cp := *h
+	cp.Counts = append([]int64(nil), h.Counts...)
+	return cp
+}
+
+// Mean returns the average observed duration.
+func (h *Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// WorkerStats is the state of a single worker, one of the WorkerState
+// constants.
+type WorkerStats struct {
+	ID     int
+	Status int
+}
+
+// PoolStats is a point in time snapshot of a WorkersPool. Failed counts jobs
+// submitted with Submit that returned an error.
+type PoolStats struct {
+	Queued    int
+	Running   int
+	Completed int
+	Failed    int
+	Cancelled int
+	Panicked  int
+	Workers   []WorkerStats
+	QueueWait Histogram
+	RunTime   Histogram
+}
+
+// PoolObserver receives the lifecycle events of every job run by a
+// WorkersPool, so they can be exported to monitoring. Its methods are called
+// synchronously from the submitting or working goroutine and should be fast.
+// workerID is -1 for jobs run in the caller.
+type PoolObserver interface {
+	WorkQueued(lane string)
+	WorkStarted(workerID int, lane string, waited time.Duration)
+	WorkFinished(workerID int, lane string, ran time.Duration, err error)
+	WorkCancelled(lane string, err error)
+}
+
+// Stats returns a snapshot of the pool counters and worker states.
+func (wp *WorkersPool) Stats() PoolStats {
+	wp.state.Lock()
+	stats := PoolStats{
+		Running:   wp.running,
+		Completed: wp.completed,
+		Failed:    wp.failed,
+		Cancelled: wp.cancelled,
+		Panicked:  wp.panics,
+		QueueWait: wp.waitHist.copy(),
+		RunTime:   wp.runHist.copy(),
+	}
+	wp.state.Unlock()
+	stats.Queued = wp.workQ.len()
+
+	wp.mutex.Lock()
+	for i, n := 0, wp.Len(); i < n; i++ {
+		w := wp.Pop().(*Worker)
+		w.mutex.RLock()
+		stats.Workers = append(stats.Workers, WorkerStats{ID: w.ID, Status: w.Status})
+		w.mutex.RUnlock()
+		wp.Push(w)
+	}
+	wp.mutex.Unlock()
+	return stats
+}
+
+func (wp *WorkersPool) queued(work WorkRequest) {
+	if wp.Observer != nil {
+		wp.Observer.WorkQueued(work.lane)
+	}
+}
+
+func (wp *WorkersPool) started(workerID int, work WorkRequest) {
+	waited := time.Since(work.queuedAt)
+	wp.state.Lock()
+	wp.running++
+	wp.waitHist.observe(waited)
+	wp.state.Unlock()
+
+	if wp.Observer != nil {
+		wp.Observer.WorkStarted(workerID, work.lane, waited)
+	}
+	wp.maybeGrow(waited)
+}
+
+func (wp *WorkersPool) ended(workerID int, work WorkRequest, ran time.Duration, err error) {
+	result := jobCompleted
+	if _, ok := err.(*PanicError); ok {
+		result = jobPanicked
+	} else if err != nil {
+		result = jobFailed
+	}
+	wp.state.Lock()
+	wp.running--
+	wp.runHist.observe(ran)
+	wp.state.Unlock()
+	wp.finish(result)
+
+	if wp.Observer != nil {
+		wp.Observer.WorkFinished(workerID, work.lane, ran, err)
+	}
+}
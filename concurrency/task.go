@@ -1,31 +1,367 @@
 package concurrency
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"math/rand"
+	"runtime/debug"
+	"sort"
+	"sync"
 	"time"
 )
 
 func TaskRunPeriodic(f func() time.Duration, task_name string, defaultInterval time.Duration) {
+	TaskRunPeriodicWithContext(context.Background(), f, task_name, defaultInterval)
+}
+
+// TaskRunPeriodicWithContext runs f until ctx is done, sleeping for the
+// interval f returns, or defaultInterval when it returns zero. A panic in f is
+// logged and f is restarted after defaultInterval.
+func TaskRunPeriodicWithContext(ctx context.Context, f func() time.Duration, task_name string, defaultInterval time.Duration) {
 	if defaultInterval < time.Second {
 		defaultInterval = time.Second
 	}
 
+	sleep := func(d time.Duration) bool {
+		select {
+		case <-time.After(d):
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
 	go func() {
 		for {
 			func() {
 				defer func() {
-					i := recover()
-					log.Println("task panic: ", i, task_name)
+					if i := recover(); i != nil {
+						log.Println("task panic: ", i, task_name)
+					}
 				}()
 				for {
-					if interval := f(); interval > 0 {
-						time.Sleep(interval)
-					} else {
-						time.Sleep(defaultInterval)
+					interval := f()
+					if interval <= 0 {
+						interval = defaultInterval
+					}
+					if !sleep(interval) {
+						return
 					}
 				}
 			}()
-			time.Sleep(defaultInterval)
+			if !sleep(defaultInterval) {
+				return
+			}
+		}
+	}()
+}
+
+// TaskRun records a single run of a scheduled task. Err is a *PanicError when
+// the task panicked.
+type TaskRun struct {
+	Start    time.Time
+	Duration time.Duration
+	Err      error
+}
+
+// TaskOption customises a task added to a Scheduler.
+type TaskOption func(*task)
+
+// WithJitter delays every activation by a random duration up to d.
+func WithJitter(d time.Duration) TaskOption {
+	return func(t *task) {
+		t.jitter = d
+	}
+}
+
+// AllowOverlap lets an activation start while the previous run is still
+// going. By default such activations are skipped.
+func AllowOverlap() TaskOption {
+	return func(t *task) {
+		t.overlap = true
+	}
+}
+
+// WithHistory keeps the last n runs of the task, 16 by default.
+func WithHistory(n int) TaskOption {
+	return func(t *task) {
+		if n > 0 {
+			t.historyLen = n
+		}
+	}
+}
+
+type task struct {
+	name       string
+	schedule   Schedule
+	f          func(context.Context) error
+	jitter     time.Duration
+	overlap    bool
+	historyLen int
+
+	sched   *Scheduler
+	ctx     context.Context
+	cancel  context.CancelFunc
+	runNow  chan struct{}
+	mutex   *sync.Mutex
+	paused  bool
+	running int
+	next    time.Time
+	history []TaskRun
+}
+
+func (t *task) loop() {
+	clock := t.sched.clock
+	var due <-chan time.Time
+	exhausted := false
+	for {
+		if due == nil && !exhausted {
+			now := clock.Now()
+			next := t.schedule.Next(now)
+			if next.IsZero() {
+				exhausted = true
+			} else {
+				if t.jitter > 0 {
+					next = next.Add(time.Duration(rand.Int63n(int64(t.jitter))))
+				}
+				due = clock.After(next.Sub(now))
+			}
+			t.mutex.Lock()
+			t.next = next
+			t.mutex.Unlock()
+		}
+
+		select {
+		case <-due:
+			due = nil
+			t.mutex.Lock()
+			paused := t.paused
+			t.mutex.Unlock()
+			if !paused {
+				t.trigger()
+			}
+		case <-t.runNow:
+			t.trigger()
+		case <-t.ctx.Done():
+			return
+		}
+	}
+}
+
+// trigger starts a run unless the task is stopped, or the previous run is
+// still going and overlaps are not allowed.
+func (t *task) trigger() {
+	// Tasks are cancelled under the scheduler lock, so a run is either added
+	// to wg before StopAll waits or not started at all.
+	t.sched.mutex.Lock()
+	defer t.sched.mutex.Unlock()
+	if t.ctx.Err() != nil {
+		return
+	}
+	t.mutex.Lock()
+	if t.running > 0 && !t.overlap {
+		t.mutex.Unlock()
+		return
+	}
+	t.running++
+	t.mutex.Unlock()
+
+	t.sched.wg.Add(1)
+	go func() {
+		defer t.sched.wg.Done()
+		run := TaskRun{Start: t.sched.clock.Now()}
+		run.Err = t.call()
+		run.Duration = t.sched.clock.Now().Sub(run.Start)
+
+		t.mutex.Lock()
+		t.running--
+		t.history = append(t.history, run)
+		if len(t.history) > t.historyLen {
+			t.history = t.history[len(t.history)-t.historyLen:]
 		}
+		t.mutex.Unlock()
 	}()
 }
+
+func (t *task) call() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{
+				Value: r,
+				Stack: debug.Stack(),
+			}
+		}
+	}()
+	return t.f(t.ctx)
+}
+
+// TaskStatus describes a task registered with a Scheduler.
+type TaskStatus struct {
+	Name    string
+	Paused  bool
+	Running bool
+	Next    time.Time
+	History []TaskRun
+}
+
+// Scheduler runs named tasks on cron expressions or fixed intervals.
+type Scheduler struct {
+	clock Clock
+	mutex *sync.Mutex
+	tasks map[string]*task
+	wg    *sync.WaitGroup
+}
+
+// NewScheduler returns a Scheduler driven by clock, or by SystemClock when
+// clock is nil.
+func NewScheduler(clock Clock) *Scheduler {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Scheduler{
+		clock: clock,
+		mutex: &sync.Mutex{},
+		tasks: make(map[string]*task),
+		wg:    &sync.WaitGroup{},
+	}
+}
+
+// AddCron registers f to run on the cron expression spec, see ParseCron.
+func (s *Scheduler) AddCron(name string, spec string, f func(context.Context) error, opts ...TaskOption) error {
+	schedule, err := ParseCron(spec)
+	if err != nil {
+		return err
+	}
+	return s.Add(name, schedule, f, opts...)
+}
+
+// AddInterval registers f to run every interval.
+func (s *Scheduler) AddInterval(name string, interval time.Duration, f func(context.Context) error, opts ...TaskOption) error {
+	return s.Add(name, Every(interval), f, opts...)
+}
+
+// Add registers f to run on schedule. The context given to f is cancelled
+// when the task or the scheduler is stopped.
+func (s *Scheduler) Add(name string, schedule Schedule, f func(context.Context) error, opts ...TaskOption) error {
+	t := &task{
+		name:       name,
+		schedule:   schedule,
+		f:          f,
+		historyLen: 16,
+		sched:      s,
+		runNow:     make(chan struct{}, 1),
+		mutex:      &sync.Mutex{},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.ctx, t.cancel = context.WithCancel(context.Background())
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("Task %s already exists.", name)
+	}
+	s.tasks[name] = t
+	go t.loop()
+	return nil
+}
+
+func (s *Scheduler) task(name string) (*task, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t, ok := s.tasks[name]
+	if !ok {
+		return nil, fmt.Errorf("Task %s not found.", name)
+	}
+	return t, nil
+}
+
+// Stop removes the task. A run in progress sees its context cancelled.
+func (s *Scheduler) Stop(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	t, ok := s.tasks[name]
+	if !ok {
+		return fmt.Errorf("Task %s not found.", name)
+	}
+	delete(s.tasks, name)
+	t.cancel()
+	return nil
+}
+
+// StopAll removes every task and waits for the runs in progress to return.
+func (s *Scheduler) StopAll() {
+	s.mutex.Lock()
+	for _, t := range s.tasks {
+		t.cancel()
+	}
+	s.tasks = make(map[string]*task)
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+// Pause skips the scheduled activations of the task until Resume.
+func (s *Scheduler) Pause(name string) error {
+	return s.setPaused(name, true)
+}
+
+func (s *Scheduler) Resume(name string) error {
+	return s.setPaused(name, false)
+}
+
+func (s *Scheduler) setPaused(name string, paused bool) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	t.paused = paused
+	t.mutex.Unlock()
+	return nil
+}
+
+// RunNow triggers the task immediately, even when it is paused. Its schedule
+// is not affected.
+func (s *Scheduler) RunNow(name string) error {
+	t, err := s.task(name)
+	if err != nil {
+		return err
+	}
+	select {
+	case t.runNow <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Status returns the state and the run history of the task, oldest run
+// first.
+func (s *Scheduler) Status(name string) (TaskStatus, error) {
+	t, err := s.task(name)
+	if err != nil {
+		return TaskStatus{}, err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return TaskStatus{
+		Name:    t.name,
+		Paused:  t.paused,
+		Running: t.running > 0,
+		Next:    t.next,
+		History: append([]TaskRun(nil), t.history...),
+	}, nil
+}
+
+// Tasks returns the names of the registered tasks, sorted.
+func (s *Scheduler) Tasks() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	names := []string{}
+	for name := range s.tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
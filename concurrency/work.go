@@ -1,46 +1,193 @@
 package concurrency
 
 import (
+	"context"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/heqzha/goutils/container"
 )
 
+// WorkQueue is shared by all workers of a pool. Requests are kept in per-lane
+// FIFOs and idle workers pull the next one, picking lanes by weight, so
+// nothing is ever re-queued or reordered within a lane.
 type WorkQueue struct {
-	q         chan WorkRequest
-	maxLength int
+	lanes  []*workLane
+	byName map[string]*workLane
+	mutex  *sync.Mutex
+	// ready holds a token while the queue may be non-empty. Each consumer that
+	// leaves items behind passes the token on.
+	ready chan struct{}
+	// space is closed and replaced whenever a work leaves the queue, waking
+	// every blocked producer.
+	space chan struct{}
 }
 
-func newWorkQueue(max int) *WorkQueue {
-	return &WorkQueue{
-		q:         make(chan WorkRequest, max),
-		maxLength: max,
+func newWorkQueue(lanes []Lane) *WorkQueue {
+	w := &WorkQueue{
+		byName: make(map[string]*workLane),
+		mutex:  &sync.Mutex{},
+		ready:  make(chan struct{}, 1),
+		space:  make(chan struct{}),
 	}
+	for _, l := range lanes {
+		lane := &workLane{Lane: l}
+		w.lanes = append(w.lanes, lane)
+		w.byName[l.Name] = lane
+	}
+	return w
 }
 
-func (w *WorkQueue) push(work WorkRequest) error {
-	if len(w.q) >= w.maxLength {
-		return fmt.Errorf("WorkQueue is full, cannot add more works.")
+// push queues work according to its policy. When the oldest work of the lane
+// had to be evicted, it is returned so the caller can cancel it. stop aborts a
+// blocked push.
+func (w *WorkQueue) push(work WorkRequest, stop <-chan struct{}) (*WorkRequest, error) {
+	var timeout <-chan time.Time
+	if work.policy == PolicyBlock && work.timeout > 0 {
+		timer := time.NewTimer(work.timeout)
+		defer timer.Stop()
+		timeout = timer.C
 	}
-	w.q <- work
-	return nil
+
+	for {
+		w.mutex.Lock()
+		lane, ok := w.byName[work.lane]
+		if !ok {
+			w.mutex.Unlock()
+			return nil, fmt.Errorf("Lane %s not found.", work.lane)
+		}
+
+		var evicted *WorkRequest
+		if lane.q.Len() >= lane.MaxDepth {
+			switch work.policy {
+			case PolicyDropOldest:
+				oldest, _ := lane.q.Pop()
+				evicted = &oldest
+			case PolicyBlock:
+				space := w.space
+				w.mutex.Unlock()
+				select {
+				case <-space:
+					continue
+				case <-work.ctx.Done():
+					return nil, work.ctx.Err()
+				case <-timeout:
+					return nil, ErrWorkQueueFull
+				case <-stop:
+					return nil, fmt.Errorf("WorkersPool is stopped.")
+				}
+			default:
+				w.mutex.Unlock()
+				return nil, ErrWorkQueueFull
+			}
+		}
+
+		work.queuedAt = time.Now()
+		lane.q.Push(work)
+		w.mutex.Unlock()
+		w.signal()
+		return evicted, nil
+	}
+}
+
+func (w *WorkQueue) pop() (WorkRequest, bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	lane := selectLane(w.lanes)
+	if lane == nil {
+		return WorkRequest{}, false
+	}
+	work, _ := lane.q.Pop()
+	if w.lenLocked() > 0 {
+		w.signal()
+	}
+	close(w.space)
+	w.space = make(chan struct{})
+	return work, true
+}
+
+func (w *WorkQueue) signal() {
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (w *WorkQueue) lenLocked() int {
+	n := 0
+	for _, l := range w.lanes {
+		n += l.q.Len()
+	}
+	return n
+}
+
+func (w *WorkQueue) len() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.lenLocked()
+}
+
+func (w *WorkQueue) laneLen(name string) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	lane, ok := w.byName[name]
+	if !ok {
+		return 0, fmt.Errorf("Lane %s not found.", name)
+	}
+	return lane.q.Len(), nil
 }
 
 func (w *WorkQueue) isFull() bool {
-	return len(w.q) >= w.maxLength
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, l := range w.lanes {
+		if l.q.Len() < l.MaxDepth {
+			return false
+		}
+	}
+	return true
 }
 
 func (w *WorkQueue) isEmpty() bool {
-	return len(w.q) == 0
+	return w.len() == 0
 }
 
 type WorkRequest struct {
-	f      func(interface{}) interface{}
-	params interface{}
-	delay  time.Duration
+	id      uint64
+	ctx     context.Context
+	lane    string
+	policy  SubmitPolicy
+	timeout time.Duration
+	// queuedAt is when the work entered the queue.
+	queuedAt time.Time
+	f        func(interface{}) interface{}
+	params   interface{}
+	// at, when set, is the earliest time the work may run.
+	at     time.Time
 	output chan interface{}
+	// cancelled is invoked instead of f when the job is skipped.
+	cancelled func(error)
+	// errResult is set when f returns the job error as its result.
+	errResult bool
+}
+
+func (work *WorkRequest) run() interface{} {
+	res := work.f(work.params)
+	if work.output != nil {
+		work.output <- res
+	}
+	return res
+}
+
+// err extracts the error a job returned, for jobs that report one.
+func (work *WorkRequest) err(res interface{}) error {
+	if !work.errResult {
+		return nil
+	}
+	err, _ := res.(error)
+	return err
 }
 
 const (
@@ -55,45 +202,112 @@ type Worker struct {
 	Status int
 	Quit   chan bool
 	mutex  *sync.RWMutex
+	pool   *WorkersPool
+	// quitting is set once Quit is closed.
+	quitting bool
 }
 
-func newWorker(id int) Worker {
+func newWorker(id int, pool *WorkersPool) Worker {
 	worker := Worker{
 		ID:     id,
-		Work:   newWorkQueue(1),
+		Work:   pool.workQ,
 		Status: WorkerStateIdle,
 		Quit:   make(chan bool),
 		mutex:  &sync.RWMutex{},
+		pool:   pool,
 	}
 	return worker
 }
 
 func (w *Worker) Start() {
-	go func() {
-		for {
+	go w.loop()
+}
+
+func (w *Worker) loop() {
+	var current *WorkRequest
+	var began time.Time
+	defer func() {
+		if r := recover(); r != nil {
+			w.recovered(current, time.Since(began), r)
+			return
+		}
+		w.pool.exited()
+	}()
+
+	for {
+		// A stopped worker takes no more work, even with a backlog.
+		if w.stopping() {
+			w.Unavailable()
+			return
+		}
+		work, ok := w.Work.pop()
+		if !ok {
+			idle, stop := w.pool.keepAlive()
 			select {
-			case work := <-w.Work.q:
-				w.Busy()
-				//Work
-				if work.output != nil {
-					work.output <- work.f(work.params)
-				} else {
-					work.f(work.params)
-				}
-				w.Idle()
-				time.Sleep(work.delay)
+			case <-w.Work.ready:
+				stop()
+				continue
 			case <-w.Quit:
+				stop()
 				w.Unavailable()
 				return
+			case <-idle:
+				if w.pool.retire(w) {
+					w.Unavailable()
+					return
+				}
+				continue
 			}
 		}
-	}()
+
+		if err := w.pool.throttle(work); err != nil {
+			w.pool.skip(work, err)
+			continue
+		}
+		if err := w.pool.cancelReason(work); err != nil {
+			w.pool.skip(work, err)
+			continue
+		}
+		w.Busy()
+		current, began = &work, time.Now()
+		w.pool.started(w.ID, work)
+		res := work.run()
+		current = nil
+		w.Idle()
+		w.pool.ended(w.ID, work, time.Since(began), work.err(res))
+	}
+}
+
+// recovered runs once the worker goroutine has died from a panic. The panic is
+// handed to the pool, which starts a fresh goroutine for this worker.
+func (w *Worker) recovered(work *WorkRequest, ran time.Duration, r interface{}) {
+	w.Unavailable()
+	perr := &PanicError{
+		WorkerID: w.ID,
+		Value:    r,
+		Stack:    debug.Stack(),
+	}
+	if work != nil {
+		perr.JobID, perr.Params = work.id, work.params
+	}
+	w.pool.panicked(w, work, ran, perr)
 }
 
+// Stop closes Quit. The worker finishes its current work, if any, then
+// exits without taking another one.
 func (w *Worker) Stop() {
-	go func() {
-		w.Quit <- true
-	}()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.quitting {
+		w.quitting = true
+		close(w.Quit)
+	}
+}
+
+func (w *Worker) stopping() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return w.quitting
 }
 
 func (w *Worker) Unavailable() {
@@ -120,82 +334,413 @@ func (w *Worker) IsAvailable() bool {
 	return w.Status == WorkerStateIdle
 }
 
+const (
+	jobCompleted = iota
+	jobFailed
+	jobCancelled
+	jobPanicked
+	// jobRejected releases a submission that never made it into the queue.
+	jobRejected
+)
+
+// ShutdownReport summarises what happened to the jobs submitted to a WorkersPool.
+// Abandoned jobs were still queued or running when the shutdown deadline hit.
+type ShutdownReport struct {
+	Completed int
+	Failed    int
+	Cancelled int
+	Panicked  int
+	Abandoned int
+}
+
 type WorkersPool struct {
 	container.Queue
 	workQ *WorkQueue
+	sched *timedQueue
 	Quit  chan bool
 	mutex *sync.Mutex
+
+	// Policy decides what submissions do when their lane is full. It can be
+	// overridden per submission with WithPolicy.
+	Policy SubmitPolicy
+
+	// Elastic, if set before the pool starts, lets the number of workers
+	// follow the load. The worker count given to Start is the initial size.
+	Elastic *ElasticConfig
+
+	// Limiter, if set, caps the rate at which works are dispatched to the
+	// workers.
+	Limiter Limiter
+
+	// Observer, if set, is notified of every job queued, started, finished
+	// or cancelled.
+	Observer PoolObserver
+
+	// PanicHandler, if set, is called with every panic recovered from a job
+	// run through Collect or CollectWithOutput.
+	PanicHandler func(*PanicError)
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	state     *sync.Mutex
+	closed    bool
+	stopped   bool
+	pending   int
+	running   int
+	completed int
+	failed    int
+	cancelled int
+	panics    int
+	waitHist  Histogram
+	runHist   Histogram
+	nextID    uint64
+	workerID  int
+	// live counts the worker goroutines, including the ones stopped or
+	// retired but still finishing a work.
+	live    int
+	drained chan struct{}
 }
 
 func (wp *WorkersPool) Start(nWorkers int, maxBuffer int) {
+	wp.StartWithContext(context.Background(), nWorkers, maxBuffer)
+}
+
+// StartWithContext starts the pool bound to ctx. Once ctx is done, queued jobs
+// are cancelled instead of being run and new submissions are rejected.
+func (wp *WorkersPool) StartWithContext(ctx context.Context, nWorkers int, maxBuffer int) {
+	wp.start(ctx, nWorkers, []Lane{{Name: DefaultLane, Weight: 1, MaxDepth: maxBuffer}})
+}
+
+// StartWithLanes starts the pool with one queue per lane instead of a single
+// buffer. Collect and CollectWithOutput submit to DefaultLane, so it has to be
+// among lanes for them to work; use OnLane to submit anywhere else.
+func (wp *WorkersPool) StartWithLanes(ctx context.Context, nWorkers int, lanes []Lane) error {
+	if len(lanes) == 0 {
+		return fmt.Errorf("WorkersPool needs at least one lane.")
+	}
+	names := map[string]bool{}
+	for _, l := range lanes {
+		if names[l.Name] {
+			return fmt.Errorf("Lane %s is declared twice.", l.Name)
+		}
+		if l.Weight <= 0 || l.MaxDepth <= 0 {
+			return fmt.Errorf("Lane %s needs a positive weight and max depth.", l.Name)
+		}
+		names[l.Name] = true
+	}
+	wp.start(ctx, nWorkers, lanes)
+	return nil
+}
+
+func (wp *WorkersPool) start(ctx context.Context, nWorkers int, lanes []Lane) {
 	wp.Clear()
 	wp.Quit = make(chan bool)
-	wp.workQ = newWorkQueue(maxBuffer)
+	wp.workQ = newWorkQueue(lanes)
+	wp.sched = newTimedQueue(wp)
 	wp.mutex = &sync.Mutex{}
+	wp.ctx, wp.cancel = context.WithCancel(ctx)
+	wp.state = &sync.Mutex{}
+	wp.closed, wp.stopped = false, false
+	wp.pending, wp.running = 0, 0
+	wp.completed, wp.failed, wp.cancelled, wp.panics = 0, 0, 0, 0
+	wp.waitHist, wp.runHist = newHistogram(), newHistogram()
+	wp.nextID, wp.workerID, wp.live = 0, 0, 0
+	wp.drained = make(chan struct{})
 
+	if wp.Elastic != nil {
+		wp.Elastic.normalize()
+		nWorkers = wp.Elastic.clamp(nWorkers)
+	}
 	for i := 0; i < nWorkers; i++ {
-		worker := newWorker(i)
-		worker.Start()
-		wp.Push(&worker)
+		wp.addWorker()
 	}
+}
 
-	go func() {
-		for {
-			select {
-			case work := <-wp.workQ.q:
-				go func() {
-					wp.mutex.Lock()
-					worker := wp.Pop().(*Worker)
-					if worker.IsAvailable() {
-						worker.Work.q <- work
-					} else {
-						time.Sleep(time.Millisecond * 50)
-						wp.workQ.push(work)
-					}
-					wp.Push(worker)
-					wp.mutex.Unlock()
-				}()
-			case <-wp.Quit:
-				return
-			}
-		}
-	}()
+func (wp *WorkersPool) addWorker() {
+	worker := newWorker(wp.workerID, wp)
+	wp.workerID++
+	worker.Start()
+	wp.Push(&worker)
+	wp.live++
+}
+
+// exited is called by a worker goroutine returning for good.
+func (wp *WorkersPool) exited() {
+	wp.mutex.Lock()
+	defer wp.mutex.Unlock()
+	wp.live--
+}
+
+func (wp *WorkersPool) isStopped() bool {
+	wp.state.Lock()
+	defer wp.state.Unlock()
+	return wp.stopped
 }
 
+// Collect queues f to run with params. A positive delay holds the work back
+// for that long without occupying a worker.
 func (wp *WorkersPool) Collect(f func(interface{}) interface{}, params interface{}, delay time.Duration) error {
-	if wp.workQ == nil {
-		return fmt.Errorf("WorkQueue is nil.")
-	}
+	return wp.CollectWithContext(context.Background(), f, params, delay)
+}
+
+// CollectWithOutput queues f like Collect and sends its result on output. If
+// f panics, the *PanicError is sent on output instead.
+func (wp *WorkersPool) CollectWithOutput(f func(interface{}) interface{}, params interface{}, delay time.Duration, output chan interface{}) error {
+	return wp.CollectWithOutputContext(context.Background(), f, params, delay, output)
+}
+
+// CollectWithContext submits f like Collect. If ctx is done before a worker
+// picks the job up, the job is skipped and counted as cancelled.
+func (wp *WorkersPool) CollectWithContext(ctx context.Context, f func(interface{}) interface{}, params interface{}, delay time.Duration, opts ...SubmitOption) error {
+	return wp.CollectWithOutputContext(ctx, f, params, delay, nil, opts...)
+}
+
+func (wp *WorkersPool) CollectWithOutputContext(ctx context.Context, f func(interface{}) interface{}, params interface{}, delay time.Duration, output chan interface{}, opts ...SubmitOption) error {
 	work := WorkRequest{
+		ctx:    ctx,
 		f:      f,
 		params: params,
-		delay:  delay,
-		output: nil,
+		output: output,
 	}
-	return wp.workQ.push(work)
+	_, err := wp.submit(work, append([]SubmitOption{RunAfter(delay)}, opts...)...)
+	return err
 }
 
-func (wp *WorkersPool) CollectWithOutput(f func(interface{}) interface{}, params interface{}, delay time.Duration, output chan interface{}) error {
+// submit accepts work into the pool. Works due in the future go to the
+// timed queue, whose handle is returned; everything else is queued right away.
+func (wp *WorkersPool) submit(work WorkRequest, opts ...SubmitOption) (*ScheduledWork, error) {
 	if wp.workQ == nil {
-		return fmt.Errorf("WorkQueue is nil.")
+		return nil, fmt.Errorf("WorkQueue is nil.")
 	}
-	work := WorkRequest{
-		f:      f,
-		params: params,
-		delay:  delay,
-		output: output,
+	work.lane = DefaultLane
+	work.policy = wp.Policy
+	for _, opt := range opts {
+		opt(&work)
+	}
+	if err := work.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := wp.ctx.Err(); err != nil {
+		return nil, fmt.Errorf("WorkersPool is stopped: %v", err)
+	}
+	if _, err := wp.workQ.laneLen(work.lane); err != nil {
+		return nil, err
+	}
+
+	wp.state.Lock()
+	if wp.closed {
+		wp.state.Unlock()
+		return nil, fmt.Errorf("WorkersPool is shutting down, cannot add more works.")
+	}
+	wp.nextID++
+	work.id = wp.nextID
+	wp.pending++
+	wp.state.Unlock()
+
+	if work.at.After(time.Now()) {
+		return wp.sched.add(work), nil
 	}
-	return wp.workQ.push(work)
+	if err := wp.enqueue(work); err != nil {
+		wp.finish(jobRejected)
+		return nil, err
+	}
+	// Work already due gets a handle that can no longer be cancelled.
+	if work.at.IsZero() {
+		work.at = time.Now()
+	}
+	return &ScheduledWork{work: work, index: -1, sched: wp.sched}, nil
 }
 
+// enqueue pushes an accepted work onto its lane according to its policy.
+func (wp *WorkersPool) enqueue(work WorkRequest) error {
+	evicted, err := wp.workQ.push(work, wp.ctx.Done())
+	if err == ErrWorkQueueFull && work.policy == PolicyCallerRuns {
+		wp.runInCaller(work)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	wp.queued(work)
+	if evicted != nil {
+		wp.skip(*evicted, ErrWorkDropped)
+	}
+	// Stop may have drained the queue before this push, in which case no
+	// worker is left to take the work.
+	if wp.isStopped() {
+		wp.drain(fmt.Errorf("WorkersPool is stopped."))
+		return nil
+	}
+	wp.maybeGrow(0)
+	return nil
+}
+
+// drain cancels every work left in the queue.
+func (wp *WorkersPool) drain(err error) {
+	for {
+		work, ok := wp.workQ.pop()
+		if !ok {
+			return
+		}
+		wp.skip(work, err)
+	}
+}
+
+// runInCaller runs work in the submitting goroutine. Panics are counted and
+// then handed back to the caller.
+func (wp *WorkersPool) runInCaller(work WorkRequest) {
+	began := time.Now()
+	wp.started(-1, work)
+	defer func() {
+		if r := recover(); r != nil {
+			wp.ended(-1, work, time.Since(began), &PanicError{
+				JobID:    work.id,
+				WorkerID: -1,
+				Params:   work.params,
+				Value:    r,
+				Stack:    debug.Stack(),
+			})
+			panic(r)
+		}
+	}()
+	res := work.run()
+	wp.ended(-1, work, time.Since(began), work.err(res))
+}
+
+// throttle waits for the pool limiter to let work through. The wait ends
+// early when the work or the pool is cancelled.
+func (wp *WorkersPool) throttle(work WorkRequest) error {
+	if wp.Limiter == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(work.ctx)
+	defer cancel()
+	stop := context.AfterFunc(wp.ctx, cancel)
+	defer stop()
+	return wp.Limiter.Wait(ctx)
+}
+
+func (wp *WorkersPool) cancelReason(work WorkRequest) error {
+	if work.ctx != nil && work.ctx.Err() != nil {
+		return work.ctx.Err()
+	}
+	return wp.ctx.Err()
+}
+
+func (wp *WorkersPool) skip(work WorkRequest, err error) {
+	if work.cancelled != nil {
+		work.cancelled(err)
+	}
+	wp.finish(jobCancelled)
+	if wp.Observer != nil {
+		wp.Observer.WorkCancelled(work.lane, err)
+	}
+}
+
+func (wp *WorkersPool) finish(result int) {
+	wp.state.Lock()
+	defer wp.state.Unlock()
+	switch result {
+	case jobCompleted:
+		wp.completed++
+	case jobCancelled:
+		wp.cancelled++
+	case jobFailed:
+		wp.failed++
+	case jobPanicked:
+		wp.panics++
+	}
+	wp.pending--
+	if wp.closed && wp.pending == 0 {
+		close(wp.drained)
+	}
+}
+
+func (wp *WorkersPool) panicked(w *Worker, work *WorkRequest, ran time.Duration, perr *PanicError) {
+	if work != nil {
+		// Callers waiting on the output get the panic instead of a result.
+		if work.output != nil {
+			work.output <- perr
+		}
+		wp.ended(w.ID, *work, ran, perr)
+	}
+	if wp.PanicHandler != nil {
+		wp.PanicHandler(perr)
+	}
+
+	if !wp.isStopped() {
+		w.Idle()
+		w.Start()
+	} else {
+		wp.exited()
+	}
+}
+
+func (wp *WorkersPool) report(abandoned int) ShutdownReport {
+	return ShutdownReport{
+		Completed: wp.completed,
+		Failed:    wp.failed,
+		Cancelled: wp.cancelled,
+		Panicked:  wp.panics,
+		Abandoned: abandoned,
+	}
+}
+
+// Shutdown stops accepting new works and waits until every buffered and
+// in-flight job has finished, then stops the workers. If ctx is done first,
+// the remaining jobs are abandoned and ctx.Err() is returned with the report.
+func (wp *WorkersPool) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	if wp.workQ == nil {
+		return ShutdownReport{}, fmt.Errorf("WorkQueue is nil.")
+	}
+	wp.state.Lock()
+	if !wp.closed {
+		wp.closed = true
+		if wp.pending == 0 {
+			close(wp.drained)
+		}
+	}
+	wp.state.Unlock()
+	wp.sched.cancelAll(fmt.Errorf("WorkersPool is shutting down."))
+
+	var err error
+	select {
+	case <-wp.drained:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	wp.state.Lock()
+	report := wp.report(wp.pending)
+	wp.state.Unlock()
+	wp.Stop()
+	return report, err
+}
+
+// Stop stops the workers without waiting for the backlog. Running works
+// finish, while the works still queued or scheduled are cancelled.
 func (wp *WorkersPool) Stop() {
+	wp.state.Lock()
+	if wp.stopped {
+		wp.state.Unlock()
+		return
+	}
+	wp.stopped = true
+	wp.state.Unlock()
+
+	wp.cancel()
+	wp.sched.stop()
+	wp.mutex.Lock()
 	for wp.Len() > 0 {
 		w := wp.Pop().(*Worker)
 		w.Stop()
 	}
-	wp.Quit <- true
+	wp.mutex.Unlock()
+	wp.drain(fmt.Errorf("WorkersPool is stopped."))
+	close(wp.Quit)
 }
 
+// IsFull reports whether every lane is full.
 func (wp *WorkersPool) IsFull() bool {
 	return wp.workQ.isFull()
 }
@@ -203,3 +748,8 @@ func (wp *WorkersPool) IsFull() bool {
 func (wp *WorkersPool) IsEmpty() bool {
 	return wp.workQ.isEmpty()
 }
+
+// LaneLen returns the number of works queued on the named lane.
+func (wp *WorkersPool) LaneLen(lane string) (int, error) {
+	return wp.workQ.laneLen(lane)
+}
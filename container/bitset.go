@@ -0,0 +1,182 @@
+package container
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// bitBlockWords is the number of words between two entries of the rank
+// index.
+const bitBlockWords = 8
+
+// BitSet is a growable set of non-negative integers stored one bit each.
+// Rank and Select use an index of the counts per 512 bits, rebuilt after
+// changes on first use. It is not safe for concurrent use.
+type BitSet struct {
+	words []uint64
+	// blocks[i] counts the bits set before word i*bitBlockWords.
+	blocks []int
+	dirty  bool
+}
+
+// NewBitSet creates a set with room for n bits before growing.
+func NewBitSet(n int) *BitSet {
+	return &BitSet{words: make([]uint64, (n+63)/64)}
+}
+
+// Set adds i, growing the set as needed. It panics if i is negative.
+func (b *BitSet) Set(i int) {
+	if i < 0 {
+		panic(fmt.Sprintf("BitSet index %d is negative.", i))
+	}
+	w := i / 64
+	if w >= len(b.words) {
+		words := make([]uint64, w+1, 2*(w+1))
+		copy(words, b.words)
+		b.words = words
+	}
+	b.words[w] |= 1 << (uint(i) % 64)
+	b.dirty = true
+}
+
+// Clear removes i, doing nothing for bits the set does not hold.
+func (b *BitSet) Clear(i int) {
+	if w := i / 64; i >= 0 && w < len(b.words) {
+		b.words[w] &^= 1 << (uint(i) % 64)
+		b.dirty = true
+	}
+}
+
+func (b *BitSet) Test(i int) bool {
+	w := i / 64
+	return i >= 0 && w < len(b.words) && b.words[w]&(1<<(uint(i)%64)) != 0
+}
+
+// Count returns the number of bits set.
+func (b *BitSet) Count() int {
+	return b.Rank(len(b.words) * 64)
+}
+
+// Len returns the number of bits the set holds without growing.
+func (b *BitSet) Len() int {
+	return len(b.words) * 64
+}
+
+func (b *BitSet) index() {
+	if !b.dirty && b.blocks != nil {
+		return
+	}
+	b.blocks = b.blocks[:0]
+	n := 0
+	for i, w := range b.words {
+		if i%bitBlockWords == 0 {
+			b.blocks = append(b.blocks, n)
+		}
+		n += bits.OnesCount64(w)
+	}
+	b.blocks = append(b.blocks, n)
+	b.dirty = false
+}
+
+// Rank returns the number of bits set below i.
+func (b *BitSet) Rank(i int) int {
+	if i <= 0 {
+		return 0
+	}
+	b.index()
+	w := i / 64
+	if w >= len(b.words) {
+		return b.blocks[len(b.blocks)-1]
+	}
+	n := b.blocks[w/bitBlockWords]
+	for j := w / bitBlockWords * bitBlockWords; j < w; j++ {
+		n += bits.OnesCount64(b.words[j])
+	}
+	return n + bits.OnesCount64(b.words[w]&(1<<(uint(i)%64)-1))
+}
+
+// Select returns the position of the bit of rank k, that is the (k+1)th bit
+// set, reporting false when fewer bits are set.
+func (b *BitSet) Select(k int) (int, bool) {
+	b.index()
+	if k < 0 || k >= b.blocks[len(b.blocks)-1] {
+		return 0, false
+	}
+	// Find the last block starting at or below k.
+	lo, hi := 0, len(b.blocks)-1
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if b.blocks[mid] <= k {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	k -= b.blocks[lo]
+	for w := lo * bitBlockWords; w < len(b.words); w++ {
+		n := bits.OnesCount64(b.words[w])
+		if k < n {
+			word := b.words[w]
+			for ; k > 0; k-- {
+				word &= word - 1
+			}
+			return w*64 + bits.TrailingZeros64(word), true
+		}
+		k -= n
+	}
+	return 0, false
+}
+
+// NextSet returns the first bit set at or after i.
+func (b *BitSet) NextSet(i int) (int, bool) {
+	if i < 0 {
+		i = 0
+	}
+	w := i / 64
+	if w >= len(b.words) {
+		return 0, false
+	}
+	word := b.words[w] >> (uint(i) % 64)
+	if word != 0 {
+		return i + bits.TrailingZeros64(word), true
+	}
+	for w++; w < len(b.words); w++ {
+		if b.words[w] != 0 {
+			return w*64 + bits.TrailingZeros64(b.words[w]), true
+		}
+	}
+	return 0, false
+}
+
+// Union adds every bit set in o.
+func (b *BitSet) Union(o *BitSet) {
+	if len(o.words) > len(b.words) {
+		words := make([]uint64, len(o.words))
+		copy(words, b.words)
+		b.words = words
+	}
+	for i, w := range o.words {
+		b.words[i] |= w
+	}
+	b.dirty = true
+}
+
+// Intersect clears every bit not set in o.
+func (b *BitSet) Intersect(o *BitSet) {
+	for i := range b.words {
+		if i < len(o.words) {
+			b.words[i] &= o.words[i]
+		} else {
+			b.words[i] = 0
+		}
+	}
+	b.dirty = true
+}
+
+// Diff clears every bit set in o.
+func (b *BitSet) Diff(o *BitSet) {
+	for i := 0; i < len(b.words) && i < len(o.words); i++ {
+		b.words[i] &^= o.words[i]
+	}
+	b.dirty = true
+}
@@ -0,0 +1,205 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueClosed is returned when pushing to a closed queue, or popping
+	// from one that has been drained.
+	ErrQueueClosed = fmt.Errorf("Queue is closed.")
+	// ErrQueueFull is returned by TryPush when the queue is at capacity.
+	ErrQueueFull = fmt.Errorf("Queue is full.")
+)
+
+// BlockingQueue is a FIFO safe for concurrent use whose consumers wait for
+// values instead of polling. Once closed, pushes fail while the values left
+// can still be popped.
+type BlockingQueue[T any] struct {
+	capacity int
+	mutex    *sync.Mutex
+	items    Deque[T]
+	closed   bool
+	// changed is closed and replaced whenever a value is pushed or popped,
+	// or the queue is closed, waking everyone waiting for it.
+	changed chan struct{}
+}
+
+// NewBlockingQueue returns a queue holding at most capacity values, or any
+// number of them when capacity is zero.
+func NewBlockingQueue[T any](capacity int) *BlockingQueue[T] {
+	return &BlockingQueue[T]{
+		capacity: capacity,
+		mutex:    &sync.Mutex{},
+		changed:  make(chan struct{}),
+	}
+}
+
+func (q *BlockingQueue[T]) broadcast() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+func (q *BlockingQueue[T]) full() bool {
+	return q.capacity > 0 && q.items.Len() >= q.capacity
+}
+
+// Push adds v, waiting for room while the queue is full.
+func (q *BlockingQueue[T]) Push(ctx context.Context, v T) error {
+	q.mutex.Lock()
+	for !q.closed && q.full() {
+		changed := q.changed
+		q.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		q.mutex.Lock()
+	}
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	q.items.Push(v)
+	q.broadcast()
+	return nil
+}
+
+// TryPush adds v unless the queue is full or closed.
+func (q *BlockingQueue[T]) TryPush(v T) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	if q.full() {
+		return ErrQueueFull
+	}
+	q.items.Push(v)
+	q.broadcast()
+	return nil
+}
+
+// Pop removes the value at the front, waiting for one while the queue is
+// empty. It returns ErrQueueClosed once the queue is closed and empty.
+func (q *BlockingQueue[T]) Pop(ctx context.Context) (T, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err := q.waitLocked(ctx, nil); err != nil {
+		var zero T
+		return zero, err
+	}
+	v, _ := q.items.Pop()
+	q.broadcast()
+	return v, nil
+}
+
+// TryPop removes the value at the front, ok is false when the queue is empty.
+func (q *BlockingQueue[T]) TryPop() (v T, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if v, ok = q.items.Pop(); ok {
+		q.broadcast()
+	}
+	return v, ok
+}
+
+// PopBatch waits for a first value then keeps collecting until it has max of
+// them or wait has passed, so that consumers can work in batches without
+// delaying a lone value for long. It returns ErrQueueClosed once the queue is
+// closed and empty.
+func (q *BlockingQueue[T]) PopBatch(ctx context.Context, max int, wait time.Duration) ([]T, error) {
+	if max < 1 {
+		max = 1
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if err := q.waitLocked(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	batch := make([]T, 0, max)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for len(batch) < max {
+		if v, ok := q.items.Pop(); ok {
+			batch = append(batch, v)
+			continue
+		}
+		// Returning a partial batch is fine once the caller or the timer
+		// gives up.
+		if q.waitLocked(ctx, timer.C) != nil {
+			break
+		}
+	}
+	q.broadcast()
+	return batch, nil
+}
+
+// waitLocked waits with the queue locked until it is not empty. It fails when
+// the queue is closed and empty, ctx is done or timeout fires.
+func (q *BlockingQueue[T]) waitLocked(ctx context.Context, timeout <-chan time.Time) error {
+	for q.items.Len() == 0 {
+		if q.closed {
+			return ErrQueueClosed
+		}
+		changed := q.changed
+		q.mutex.Unlock()
+		var err error
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-timeout:
+			err = context.DeadlineExceeded
+		}
+		q.mutex.Lock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close makes pushes fail and wakes every waiter. Consumers can still drain
+// the values left.
+func (q *BlockingQueue[T]) Close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.broadcast()
+	}
+}
+
+// Drain removes and returns every value left.
+func (q *BlockingQueue[T]) Drain() []T {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	values := make([]T, 0, q.items.Len())
+	for {
+		v, ok := q.items.Pop()
+		if !ok {
+			break
+		}
+		values = append(values, v)
+	}
+	q.broadcast()
+	return values
+}
+
+func (q *BlockingQueue[T]) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.items.Len()
+}
+
+func (q *BlockingQueue[T]) Closed() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.closed
+}
@@ -0,0 +1,504 @@
+package container
+
+import (
+	"container/heap"
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EvictionPolicy int
+
+const (
+	// EvictLRU evicts the least recently used entry first.
+	EvictLRU EvictionPolicy = iota
+	// EvictLFU evicts the least frequently used entry first, the least
+	// recently used among equals.
+	EvictLFU
+)
+
+type EvictReason int
+
+const (
+	// EvictedCapacity entries made room for others.
+	EvictedCapacity EvictReason = iota
+	// EvictedExpired entries outlived their TTL.
+	EvictedExpired
+	// EvictedDeleted entries were deleted or replaced.
+	EvictedDeleted
+)
+
+// CacheOptions configures a Cache. The cache holds entries up to a total cost
+// of MaxCost across all shards, each entry costing Cost(value), 1 by
+// default; a zero MaxCost means no limit. Room is made in the shard written
+// to first, then in the others. Entries expire after TTL unless set with their own TTL, or
+// never when it is zero. Keys are spread over Shards shards, 16 by default,
+// using Hash, which defaults to FNV over strings, integers and fmt.Sprint of
+// anything else. OnEvict is called, with the shard locked, for every entry
+// leaving the cache. Loader fills GetOrLoad misses.
+type CacheOptions[K comparable, V any] struct {
+	Shards  int
+	MaxCost int64
+	Cost    func(value V) int64
+	Policy  EvictionPolicy
+	TTL     time.Duration
+	Hash    func(key K) uint64
+	OnEvict func(key K, value V, reason EvictReason)
+	Loader  func(key K) (V, error)
+}
+
+// CacheStats counts the cache activity since it was created.
+type CacheStats struct {
+	Hits       uint64
+	Misses     uint64
+	Evictions  uint64
+	Loads      uint64
+	LoadErrors uint64
+}
+
+func (s CacheStats) HitRatio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+type cacheEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	cost    int64
+	expires time.Time
+	// elem is the position in the LRU list, freq, tick and index the one in
+	// the LFU heap.
+	elem  *list.Element
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+func (e *cacheEntry[K, V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// cacheOrder ranks the entries of a shard for eviction.
+type cacheOrder[K comparable, V any] interface {
+	add(e *cacheEntry[K, V])
+	touch(e *cacheEntry[K, V])
+	remove(e *cacheEntry[K, V])
+	victim() *cacheEntry[K, V]
+}
+
+type lruOrder[K comparable, V any] struct {
+	l *list.List
+}
+
+func (o lruOrder[K, V]) add(e *cacheEntry[K, V]) {
+	e.elem = o.l.PushFront(e)
+}
+
+func (o lruOrder[K, V]) touch(e *cacheEntry[K, V]) {
+	o.l.MoveToFront(e.elem)
+}
+
+func (o lruOrder[K, V]) remove(e *cacheEntry[K, V]) {
+	o.l.Remove(e.elem)
+}
+
+func (o lruOrder[K, V]) victim() *cacheEntry[K, V] {
+	if back := o.l.Back(); back != nil {
+		return back.Value.(*cacheEntry[K, V])
+	}
+	return nil
+}
+
+type lfuOrder[K comparable, V any] struct {
+	entries []*cacheEntry[K, V]
+	tick    uint64
+}
+
+func (o *lfuOrder[K, V]) Len() int {
+	return len(o.entries)
+}
+
+func (o *lfuOrder[K, V]) Less(i, j int) bool {
+	a, b := o.entries[i], o.entries[j]
+	if a.freq == b.freq {
+		return a.tick < b.tick
+	}
+	return a.freq < b.freq
+}
+
+func (o *lfuOrder[K, V]) Swap(i, j int) {
+	o.entries[i], o.entries[j] = o.entries[j], o.entries[i]
+	o.entries[i].index = i
+	o.entries[j].index = j
+}
+
+func (o *lfuOrder[K, V]) Push(x interface{}) {
+	e := x.(*cacheEntry[K, V])
+	e.index = len(o.entries)
+	o.entries = append(o.entries, e)
+}
+
+func (o *lfuOrder[K, V]) Pop() interface{} {
+	n := len(o.entries) - 1
+	e := o.entries[n]
+	o.entries[n] = nil
+	o.entries = o.entries[:n]
+	return e
+}
+
+func (o *lfuOrder[K, V]) add(e *cacheEntry[K, V]) {
+	o.tick++
+	e.freq, e.tick = 1, o.tick
+	heap.Push(o, e)
+}
+
+func (o *lfuOrder[K, V]) touch(e *cacheEntry[K, V]) {
+	o.tick++
+	e.freq++
+	e.tick = o.tick
+	heap.Fix(o, e.index)
+}
+
+func (o *lfuOrder[K, V]) remove(e *cacheEntry[K, V]) {
+	heap.Remove(o, e.index)
+}
+
+func (o *lfuOrder[K, V]) victim() *cacheEntry[K, V] {
+	if len(o.entries) == 0 {
+		return nil
+	}
+	return o.entries[0]
+}
+
+type cacheLoad[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// stale is set when the key is set or deleted during the load, whose
+	// result must then not be cached.
+	stale bool
+}
+
+type cacheShard[K comparable, V any] struct {
+	mutex   *sync.Mutex
+	entries map[K]*cacheEntry[K, V]
+	order   cacheOrder[K, V]
+	loading map[K]*cacheLoad[V]
+}
+
+// Cache is an in-memory cache safe for concurrent use, split in shards each
+// with its own lock.
+type Cache[K comparable, V any] struct {
+	opts   CacheOptions[K, V]
+	shards []*cacheShard[K, V]
+	// cost is the total cost of the entries, and next the shard shrink
+	// starts evicting from.
+	cost       int64
+	next       uint32
+	hits       uint64
+	misses     uint64
+	evictions  uint64
+	loads      uint64
+	loadErrors uint64
+}
+
+func NewCache[K comparable, V any](opts CacheOptions[K, V]) *Cache[K, V] {
+	if opts.Shards < 1 {
+		opts.Shards = 16
+	}
+	if opts.Cost == nil {
+		opts.Cost = func(V) int64 { return 1 }
+	}
+	if opts.Hash == nil {
+		opts.Hash = hashKey[K]
+	}
+	c := &Cache[K, V]{
+		opts:   opts,
+		shards: make([]*cacheShard[K, V], opts.Shards),
+	}
+	for i := range c.shards {
+		var order cacheOrder[K, V] = lruOrder[K, V]{list.New()}
+		if opts.Policy == EvictLFU {
+			order = &lfuOrder[K, V]{}
+		}
+		c.shards[i] = &cacheShard[K, V]{
+			mutex:   &sync.Mutex{},
+			entries: make(map[K]*cacheEntry[K, V]),
+			order:   order,
+			loading: make(map[K]*cacheLoad[V]),
+		}
+	}
+	return c
+}
+
+func hashKey[K comparable](key K) uint64 {
+	switch k := any(key).(type) {
+	case string:
+		// FNV-1a, inlined to avoid allocating a hash.Hash.
+		h := uint64(14695981039346656037)
+		for i := 0; i < len(k); i++ {
+			h ^= uint64(k[i])
+			h *= 1099511628211
+		}
+		return h
+	case int:
+		return mixHash(uint64(k))
+	case int64:
+		return mixHash(uint64(k))
+	case uint64:
+		return mixHash(k)
+	case int32:
+		return mixHash(uint64(k))
+	case uint32:
+		return mixHash(uint64(k))
+	}
+	h := fnv.New64a()
+	fmt.Fprint(h, key)
+	return h.Sum64()
+}
+
+// mixHash spreads consecutive integers over the shards.
+func mixHash(x uint64) uint64 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
+
+func (c *Cache[K, V]) shard(key K) *cacheShard[K, V] {
+	return c.shards[c.opts.Hash(key)%uint64(len(c.shards))]
+}
+
+// evict removes e from s, with s locked.
+func (c *Cache[K, V]) evict(s *cacheShard[K, V], e *cacheEntry[K, V], reason EvictReason) {
+	delete(s.entries, e.key)
+	s.order.remove(e)
+	atomic.AddInt64(&c.cost, -e.cost)
+	if reason != EvictedDeleted {
+		atomic.AddUint64(&c.evictions, 1)
+	}
+	if c.opts.OnEvict != nil {
+		c.opts.OnEvict(e.key, e.value, reason)
+	}
+}
+
+// Get returns the value of key unless it is missing or expired.
+func (c *Cache[K, V]) Get(key K) (v V, ok bool) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return c.getLocked(s, key)
+}
+
+func (c *Cache[K, V]) getLocked(s *cacheShard[K, V], key K) (v V, ok bool) {
+	e, ok := s.entries[key]
+	if ok && e.expired(time.Now()) {
+		c.evict(s, e, EvictedExpired)
+		ok = false
+	}
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return v, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	s.order.touch(e)
+	return e.value, true
+}
+
+// Set stores value under key with the default TTL. It returns false if the
+// value costs more than MaxCost.
+func (c *Cache[K, V]) Set(key K, value V) bool {
+	return c.SetWithTTL(key, value, c.opts.TTL)
+}
+
+// SetWithTTL stores value under key for ttl, or for good when ttl is zero.
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) bool {
+	s := c.shard(key)
+	s.mutex.Lock()
+	if l, loading := s.loading[key]; loading {
+		l.stale = true
+	}
+	ok := c.setLocked(s, key, value, ttl)
+	s.mutex.Unlock()
+	c.shrink(s)
+	return ok
+}
+
+// over reports whether adding cost would take the cache over MaxCost.
+func (c *Cache[K, V]) over(cost int64) bool {
+	return c.opts.MaxCost > 0 && atomic.LoadInt64(&c.cost)+cost > c.opts.MaxCost
+}
+
+// makeRoom evicts from s, with s locked, until cost more fits within MaxCost
+// or s is empty.
+func (c *Cache[K, V]) makeRoom(s *cacheShard[K, V], cost int64) {
+	now := time.Now()
+	for c.over(cost) {
+		victim := s.order.victim()
+		if victim == nil {
+			return
+		}
+		reason := EvictedCapacity
+		if victim.expired(now) {
+			reason = EvictedExpired
+		}
+		c.evict(s, victim, reason)
+	}
+}
+
+// shrink evicts from the shards other than skip, one shard locked at a
+// time, until the cache is within MaxCost. It is needed when the shard
+// written to has nothing left to evict.
+func (c *Cache[K, V]) shrink(skip *cacheShard[K, V]) {
+	start := int(atomic.AddUint32(&c.next, 1))
+	for i := 0; i < len(c.shards) && c.over(0); i++ {
+		s := c.shards[(start+i)%len(c.shards)]
+		if s == skip {
+			continue
+		}
+		s.mutex.Lock()
+		c.makeRoom(s, 0)
+		s.mutex.Unlock()
+	}
+}
+
+func (c *Cache[K, V]) setLocked(s *cacheShard[K, V], key K, value V, ttl time.Duration) bool {
+	cost := c.opts.Cost(value)
+	if c.opts.MaxCost > 0 && cost > c.opts.MaxCost {
+		return false
+	}
+	if old, ok := s.entries[key]; ok {
+		c.evict(s, old, EvictedDeleted)
+	}
+	e := &cacheEntry[K, V]{key: key, value: value, cost: cost}
+	if ttl > 0 {
+		e.expires = time.Now().Add(ttl)
+	}
+	// Make room in this shard first, dropping the expired victims along the
+	// way; the caller shrinks the other shards if that is not enough.
+	c.makeRoom(s, cost)
+	s.entries[key] = e
+	s.order.add(e)
+	atomic.AddInt64(&c.cost, cost)
+	return true
+}
+
+// GetOrLoad returns the value of key, calling Loader on a miss and caching
+// its result. Concurrent misses on the same key share a single load. A load
+// overtaken by a Set or Delete of the key is returned but not cached, so it
+// cannot replace a newer value.
+func (c *Cache[K, V]) GetOrLoad(key K) (V, error) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	if v, ok := c.getLocked(s, key); ok {
+		s.mutex.Unlock()
+		return v, nil
+	}
+	if c.opts.Loader == nil {
+		s.mutex.Unlock()
+		var zero V
+		return zero, fmt.Errorf("Cache has no loader.")
+	}
+	if l, ok := s.loading[key]; ok {
+		s.mutex.Unlock()
+		<-l.done
+		return l.value, l.err
+	}
+	l := &cacheLoad[V]{done: make(chan struct{})}
+	s.loading[key] = l
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.loading, key)
+		if l.err == nil && !l.stale {
+			c.setLocked(s, key, l.value, c.opts.TTL)
+		}
+		s.mutex.Unlock()
+		c.shrink(s)
+		close(l.done)
+	}()
+	atomic.AddUint64(&c.loads, 1)
+	// Kept if Loader panics, so waiters do not read a zero value as success.
+	l.err = fmt.Errorf("Cache loader panicked.")
+	l.value, l.err = c.opts.Loader(key)
+	if l.err != nil {
+		atomic.AddUint64(&c.loadErrors, 1)
+	}
+	return l.value, l.err
+}
+
+// Delete removes key, reporting whether it was there.
+func (c *Cache[K, V]) Delete(key K) bool {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if l, loading := s.loading[key]; loading {
+		l.stale = true
+	}
+	e, ok := s.entries[key]
+	if ok {
+		c.evict(s, e, EvictedDeleted)
+	}
+	return ok
+}
+
+// DeleteExpired removes every expired entry. Expired entries are otherwise
+// only removed when looked up or evicted.
+func (c *Cache[K, V]) DeleteExpired() {
+	now := time.Now()
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		for _, e := range s.entries {
+			if e.expired(now) {
+				c.evict(s, e, EvictedExpired)
+			}
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Purge removes every entry.
+func (c *Cache[K, V]) Purge() {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		for _, e := range s.entries {
+			c.evict(s, e, EvictedDeleted)
+		}
+		for _, l := range s.loading {
+			l.stale = true
+		}
+		s.mutex.Unlock()
+	}
+}
+
+// Len returns the number of entries, expired ones included.
+func (c *Cache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		n += len(s.entries)
+		s.mutex.Unlock()
+	}
+	return n
+}
+
+// Cost returns the total cost of the entries.
+func (c *Cache[K, V]) Cost() int64 {
+	return atomic.LoadInt64(&c.cost)
+}
+
+func (c *Cache[K, V]) Stats() CacheStats {
+	return CacheStats{
+		Hits:       atomic.LoadUint64(&c.hits),
+		Misses:     atomic.LoadUint64(&c.misses),
+		Evictions:  atomic.LoadUint64(&c.evictions),
+		Loads:      atomic.LoadUint64(&c.loads),
+		LoadErrors: atomic.LoadUint64(&c.loadErrors),
+	}
+}
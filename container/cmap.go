@@ -0,0 +1,134 @@
+package container
+
+import (
+	"sync"
+)
+
+type cmapShard[K comparable, V any] struct {
+	m     map[K]V
+	mutex *sync.RWMutex
+}
+
+// ConcurrentMap is a map safe for concurrent use, split in shards each
+// guarded by its own RWMutex so that writers to different keys rarely
+// contend. Keys are hashed as in Cache.
+type ConcurrentMap[K comparable, V any] struct {
+	shards []*cmapShard[K, V]
+}
+
+// NewConcurrentMap creates a map with the given number of shards, 16 when
+// shards is not positive.
+func NewConcurrentMap[K comparable, V any](shards int) *ConcurrentMap[K, V] {
+	if shards < 1 {
+		shards = 16
+	}
+	c := &ConcurrentMap[K, V]{shards: make([]*cmapShard[K, V], shards)}
+	for i := range c.shards {
+		c.shards[i] = &cmapShard[K, V]{
+			m:     make(map[K]V),
+			mutex: &sync.RWMutex{},
+		}
+	}
+	return c
+}
+
+func (c *ConcurrentMap[K, V]) shard(key K) *cmapShard[K, V] {
+	return c.shards[hashKey(key)%uint64(len(c.shards))]
+}
+
+func (c *ConcurrentMap[K, V]) Get(key K) (V, bool) {
+	s := c.shard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	v, ok := s.m[key]
+	return v, ok
+}
+
+func (c *ConcurrentMap[K, V]) Set(key K, value V) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.m[key] = value
+}
+
+// Delete removes key, returning its value if it was there.
+func (c *ConcurrentMap[K, V]) Delete(key K) (V, bool) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	v, ok := s.m[key]
+	delete(s.m, key)
+	return v, ok
+}
+
+// ComputeIfAbsent returns the value of key, storing the result of create
+// first if key is missing. create runs at most once per missing key, with
+// the shard locked, so it must not use the map. loaded reports whether the
+// value was already there.
+func (c *ConcurrentMap[K, V]) ComputeIfAbsent(key K, create func(key K) V) (v V, loaded bool) {
+	s := c.shard(key)
+	s.mutex.RLock()
+	v, loaded = s.m[key]
+	s.mutex.RUnlock()
+	if loaded {
+		return v, true
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if v, loaded = s.m[key]; loaded {
+		return v, true
+	}
+	v = create(key)
+	s.m[key] = v
+	return v, false
+}
+
+// Compute replaces the value of key with the result of update, which gets
+// the current value if any and deletes key when keep is false. update runs
+// with the shard locked, so it must not use the map.
+func (c *ConcurrentMap[K, V]) Compute(key K, update func(old V, ok bool) (v V, keep bool)) (V, bool) {
+	s := c.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	old, ok := s.m[key]
+	v, keep := update(old, ok)
+	if keep {
+		s.m[key] = v
+	} else {
+		delete(s.m, key)
+	}
+	return v, keep
+}
+
+func (c *ConcurrentMap[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mutex.RLock()
+		n += len(s.m)
+		s.mutex.RUnlock()
+	}
+	return n
+}
+
+// Range calls f on every entry until it returns false, locking one shard at
+// a time; entries changed meanwhile in other shards may or may not be seen.
+func (c *ConcurrentMap[K, V]) Range(f func(key K, value V) bool) {
+	for _, s := range c.shards {
+		s.mutex.RLock()
+		for k, v := range s.m {
+			if !f(k, v) {
+				s.mutex.RUnlock()
+				return
+			}
+		}
+		s.mutex.RUnlock()
+	}
+}
+
+func (c *ConcurrentMap[K, V]) Clear() {
+	for _, s := range c.shards {
+		s.mutex.Lock()
+		s.m = make(map[K]V)
+		s.mutex.Unlock()
+	}
+}
@@ -0,0 +1,195 @@
+package container
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Deadlines are kept in Unix nanoseconds, which only cover the years 1678 to
+// 2262; earlier and later ones, such as the zero time, are clamped.
+var (
+	minDeadline = time.Unix(0, math.MinInt64)
+	maxDeadline = time.Unix(0, math.MaxInt64)
+)
+
+func deadline(at time.Time) int64 {
+	if at.Before(minDeadline) {
+		return math.MinInt64
+	}
+	if at.After(maxDeadline) {
+		return math.MaxInt64
+	}
+	return at.UnixNano()
+}
+
+// DelayQueue holds values until their deadline, popping them in deadline
+// order. It is not safe for concurrent use, see BlockingDelayQueue.
+type DelayQueue[T any] struct {
+	q *PriorityQueue[T]
+}
+
+func NewDelayQueue[T any]() *DelayQueue[T] {
+	return &DelayQueue[T]{
+		q: NewPriorityQueue[T](MinFirst),
+	}
+}
+
+func (d *DelayQueue[T]) Len() int {
+	return d.q.Len()
+}
+
+// Push adds v to be popped from at onwards. The priority of the returned
+// item is at in Unix nanoseconds, clamped to the int64 range.
+func (d *DelayQueue[T]) Push(v T, at time.Time) *PriorityItem[T] {
+	return d.q.Push(v, deadline(at))
+}
+
+// Pop removes the value with the earliest deadline if it has passed.
+func (d *DelayQueue[T]) Pop() (v T, ok bool) {
+	if _, at, ok := d.Peek(); !ok || at.After(time.Now()) {
+		return v, false
+	}
+	v, _, ok = d.q.Pop()
+	return v, ok
+}
+
+// Peek returns the value with the earliest deadline, due or not.
+func (d *DelayQueue[T]) Peek() (v T, at time.Time, ok bool) {
+	v, p, ok := d.q.Peek()
+	if !ok {
+		return v, at, false
+	}
+	return v, time.Unix(0, p), true
+}
+
+// Update moves the deadline of item to at.
+func (d *DelayQueue[T]) Update(item *PriorityItem[T], at time.Time) bool {
+	return d.q.Update(item, deadline(at))
+}
+
+func (d *DelayQueue[T]) Remove(item *PriorityItem[T]) bool {
+	return d.q.Remove(item)
+}
+
+// BlockingDelayQueue is a DelayQueue safe for concurrent use whose consumers
+// wait for the next deadline. Once closed, pushes fail while the values left
+// are still popped as they fall due.
+type BlockingDelayQueue[T any] struct {
+	d       *DelayQueue[T]
+	mutex   *sync.Mutex
+	closed  bool
+	changed chan struct{}
+}
+
+func NewBlockingDelayQueue[T any]() *BlockingDelayQueue[T] {
+	return &BlockingDelayQueue[T]{
+		d:       NewDelayQueue[T](),
+		mutex:   &sync.Mutex{},
+		changed: make(chan struct{}),
+	}
+}
+
+func (b *BlockingDelayQueue[T]) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *BlockingDelayQueue[T]) Push(v T, at time.Time) (*PriorityItem[T], error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil, ErrQueueClosed
+	}
+	item := b.d.Push(v, at)
+	b.broadcast()
+	return item, nil
+}
+
+// Pop waits until the earliest deadline passes and removes its value. It
+// returns ErrQueueClosed once the queue is closed and empty.
+func (b *BlockingDelayQueue[T]) Pop(ctx context.Context) (v T, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for {
+		_, at, ok := b.d.Peek()
+		if !ok && b.closed {
+			return v, ErrQueueClosed
+		}
+		var timer *time.Timer
+		var due <-chan time.Time
+		if ok {
+			wait := time.Until(at)
+			if wait <= 0 {
+				v, _ = b.d.Pop()
+				b.broadcast()
+				return v, nil
+			}
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+
+		// Wait for the deadline, or for a push or removal changing it.
+		changed := b.changed
+		b.mutex.Unlock()
+		select {
+		case <-due:
+		case <-changed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		b.mutex.Lock()
+		if err != nil {
+			return v, err
+		}
+	}
+}
+
+func (b *BlockingDelayQueue[T]) TryPop() (v T, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if v, ok = b.d.Pop(); ok {
+		b.broadcast()
+	}
+	return v, ok
+}
+
+func (b *BlockingDelayQueue[T]) Update(item *PriorityItem[T], at time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.d.Update(item, at) {
+		return false
+	}
+	b.broadcast()
+	return true
+}
+
+func (b *BlockingDelayQueue[T]) Remove(item *PriorityItem[T]) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.d.Remove(item) {
+		return false
+	}
+	b.broadcast()
+	return true
+}
+
+func (b *BlockingDelayQueue[T]) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.d.Len()
+}
+
+// Close makes pushes fail and wakes every waiter.
+func (b *BlockingDelayQueue[T]) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.broadcast()
+	}
+}
@@ -0,0 +1,146 @@
+package container
+
+const minDequeCap = 16
+
+// Deque is a double-ended queue stored in a ring buffer which grows and
+// shrinks with its content, so that every operation is amortized O(1). The
+// zero value is an empty deque ready to use. It is not safe for concurrent
+// use.
+type Deque[T any] struct {
+	buf  []T
+	head int
+	n    int
+}
+
+// NewDeque returns a deque with room for capacity values before growing.
+func NewDeque[T any](capacity int) *Deque[T] {
+	c := minDequeCap
+	for c < capacity {
+		c <<= 1
+	}
+	return &Deque[T]{buf: make([]T, c)}
+}
+
+func (q *Deque[T]) Len() int {
+	return q.n
+}
+
+// index maps the i-th value from the front to its slot. len(q.buf) is always
+// a power of two.
+func (q *Deque[T]) index(i int) int {
+	return (q.head + i) & (len(q.buf) - 1)
+}
+
+func (q *Deque[T]) resize(c int) {
+	buf := make([]T, c)
+	if q.head+q.n <= len(q.buf) {
+		copy(buf, q.buf[q.head:q.head+q.n])
+	} else {
+		k := copy(buf, q.buf[q.head:])
+		copy(buf[k:], q.buf[:q.n-k])
+	}
+	q.buf = buf
+	q.head = 0
+}
+
+func (q *Deque[T]) grow() {
+	if q.n < len(q.buf) {
+		return
+	}
+	c := len(q.buf) << 1
+	if c < minDequeCap {
+		c = minDequeCap
+	}
+	q.resize(c)
+}
+
+// shrink halves the buffer once it is at most a quarter full.
+func (q *Deque[T]) shrink() {
+	if len(q.buf) > minDequeCap && q.n <= len(q.buf)>>2 {
+		q.resize(len(q.buf) >> 1)
+	}
+}
+
+// Push adds v at the back.
+func (q *Deque[T]) Push(v T) {
+	q.grow()
+	q.buf[q.index(q.n)] = v
+	q.n++
+}
+
+// PushFront adds v at the front.
+func (q *Deque[T]) PushFront(v T) {
+	q.grow()
+	q.head = q.index(len(q.buf) - 1)
+	q.buf[q.head] = v
+	q.n++
+}
+
+// Pop removes and returns the value at the front, ok is false when empty.
+func (q *Deque[T]) Pop() (v T, ok bool) {
+	if q.n == 0 {
+		return v, false
+	}
+	var zero T
+	v = q.buf[q.head]
+	q.buf[q.head] = zero
+	q.head = q.index(1)
+	q.n--
+	q.shrink()
+	return v, true
+}
+
+// PopBack removes and returns the value at the back, ok is false when empty.
+func (q *Deque[T]) PopBack() (v T, ok bool) {
+	if q.n == 0 {
+		return v, false
+	}
+	var zero T
+	i := q.index(q.n - 1)
+	v = q.buf[i]
+	q.buf[i] = zero
+	q.n--
+	q.shrink()
+	return v, true
+}
+
+// Peek returns the value at the front without removing it.
+func (q *Deque[T]) Peek() (v T, ok bool) {
+	if q.n == 0 {
+		return v, false
+	}
+	return q.buf[q.head], true
+}
+
+// PeekBack returns the value at the back without removing it.
+func (q *Deque[T]) PeekBack() (v T, ok bool) {
+	if q.n == 0 {
+		return v, false
+	}
+	return q.buf[q.index(q.n-1)], true
+}
+
+// At returns the i-th value from the front. It panics if i is out of range.
+func (q *Deque[T]) At(i int) T {
+	if i < 0 || i >= q.n {
+		panic("container: Deque index out of range")
+	}
+	return q.buf[q.index(i)]
+}
+
+// All calls yield for every value from front to back until it returns false.
+// It can be ranged over: for i, v := range q.All.
+func (q *Deque[T]) All(yield func(i int, v T) bool) {
+	for i := 0; i < q.n; i++ {
+		if !yield(i, q.buf[q.index(i)]) {
+			return
+		}
+	}
+}
+
+// Clear removes every value and releases the buffer.
+func (q *Deque[T]) Clear() {
+	q.buf = nil
+	q.head = 0
+	q.n = 0
+}
@@ -0,0 +1,467 @@
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/heqzha/goutils/file"
+)
+
+const (
+	diskSegmentExt = ".seg"
+	diskAckLog     = "ack.log"
+	// diskHeaderSize is the crc32 of id and data, the length of data and the
+	// id heading every record of a segment.
+	diskHeaderSize = 4 + 4 + 8
+)
+
+// DiskQueueOptions configures a DiskQueue. Segments are rolled over once they
+// reach SegmentSize bytes, 64MB by default. Sync flushes every push and ack
+// to disk before returning, at the cost of throughput.
+type DiskQueueOptions struct {
+	SegmentSize int64
+	Sync        bool
+}
+
+// DiskMessage is a value popped from a DiskQueue, to be acked or nacked by ID.
+type DiskMessage struct {
+	ID   uint64
+	Data []byte
+}
+
+type diskSegment struct {
+	first, last uint64
+	path        string
+	f           *os.File
+	size        int64
+	unacked     int
+}
+
+type diskRef struct {
+	id     uint64
+	seg    *diskSegment
+	offset int64
+	size   int
+}
+
+// DiskQueue is a FIFO persisted to a directory, safe for concurrent use.
+// Values are appended to segment files and have to be acked once handled;
+// nacked values are delivered again first, and values neither acked nor
+// nacked before a crash are delivered again when the queue is reopened.
+// Segments whose values are all acked are deleted.
+type DiskQueue struct {
+	dir      string
+	opts     DiskQueueOptions
+	mutex    *sync.Mutex
+	segments []*diskSegment
+	acks     *os.File
+	// acked holds the acked ids of the live segments, so that the ack log
+	// can be rewritten when a segment goes.
+	acked    map[uint64]struct{}
+	nextID   uint64
+	ready    Deque[diskRef]
+	inflight map[uint64]diskRef
+	closed   bool
+}
+
+// OpenDiskQueue opens the queue stored in dir, creating dir if needed, and
+// replays its segments to recover the values not acked yet.
+func OpenDiskQueue(dir string, opts DiskQueueOptions) (*DiskQueue, error) {
+	if opts.SegmentSize <= 0 {
+		opts.SegmentSize = 64 << 20
+	}
+	if err := file.MkPath(dir, 0755); err != nil {
+		return nil, err
+	}
+	q := &DiskQueue{
+		dir:      dir,
+		opts:     opts,
+		mutex:    &sync.Mutex{},
+		acked:    make(map[uint64]struct{}),
+		nextID:   1,
+		inflight: make(map[uint64]diskRef),
+	}
+	if err := q.recover(); err != nil {
+		q.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *DiskQueue) recover() error {
+	acks, err := os.OpenFile(filepath.Join(q.dir, diskAckLog), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	q.acks = acks
+	if err := syncDir(q.dir); err != nil {
+		return err
+	}
+	if err := q.readAcks(); err != nil {
+		return err
+	}
+
+	names, err := file.GetFilesList(q.dir)
+	if err != nil {
+		return err
+	}
+	firsts := []uint64{}
+	for _, name := range names {
+		if !strings.HasSuffix(name, diskSegmentExt) {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, diskSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts = append(firsts, first)
+	}
+	sort.Slice(firsts, func(i, j int) bool { return firsts[i] < firsts[j] })
+
+	for i, first := range firsts {
+		seg := &diskSegment{first: first, last: first - 1, path: q.segmentPath(first)}
+		if seg.f, err = os.OpenFile(seg.path, os.O_RDWR|os.O_APPEND, 0644); err != nil {
+			return err
+		}
+		q.segments = append(q.segments, seg)
+		if err := q.replay(seg, i == len(firsts)-1); err != nil {
+			return err
+		}
+		if seg.last >= q.nextID {
+			q.nextID = seg.last + 1
+		}
+	}
+	if len(q.segments) == 0 {
+		return q.roll()
+	}
+	q.compact()
+	return nil
+}
+
+func (q *DiskQueue) readAcks() error {
+	if _, err := q.acks.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(q.acks)
+	if err != nil {
+		return err
+	}
+	// Drop an id torn by a crash.
+	if n := len(data) - len(data)%8; n != len(data) {
+		if err := q.acks.Truncate(int64(n)); err != nil {
+			return err
+		}
+		data = data[:n]
+	}
+	for i := 0; i < len(data); i += 8 {
+		q.acked[binary.BigEndian.Uint64(data[i:])] = struct{}{}
+	}
+	return nil
+}
+
+// replay queues the values of seg which were not acked. A torn record at the
+// end of the last segment is cut off, anywhere else it is an error.
+func (q *DiskQueue) replay(seg *diskSegment, last bool) error {
+	if _, err := seg.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(seg.f)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		id, size, ok := diskRecord(data[offset:])
+		if !ok {
+			if !last {
+				return fmt.Errorf("Segment %s is corrupted at offset %d.", seg.path, offset)
+			}
+			if err := seg.f.Truncate(int64(offset)); err != nil {
+				return err
+			}
+			break
+		}
+		seg.last = id
+		if _, acked := q.acked[id]; !acked {
+			seg.unacked++
+			q.ready.Push(diskRef{id: id, seg: seg, offset: int64(offset + diskHeaderSize), size: size})
+		}
+		offset += diskHeaderSize + size
+	}
+	seg.size = int64(offset)
+	return nil
+}
+
+// diskRecord decodes the record heading data, ok is false if it is torn.
+func diskRecord(data []byte) (id uint64, size int, ok bool) {
+	if len(data) < diskHeaderSize {
+		return 0, 0, false
+	}
+	sum := binary.BigEndian.Uint32(data)
+	size = int(binary.BigEndian.Uint32(data[4:]))
+	if len(data) < diskHeaderSize+size || crc32.ChecksumIEEE(data[8:diskHeaderSize+size]) != sum {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(data[8:]), size, true
+}
+
+func (q *DiskQueue) segmentPath(first uint64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d%s", first, diskSegmentExt))
+}
+
+func (q *DiskQueue) active() *diskSegment {
+	return q.segments[len(q.segments)-1]
+}
+
+// roll starts a new segment at the next id.
+func (q *DiskQueue) roll() error {
+	seg := &diskSegment{first: q.nextID, last: q.nextID - 1, path: q.segmentPath(q.nextID)}
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := syncDir(q.dir); err != nil {
+		f.Close()
+		os.Remove(seg.path)
+		return err
+	}
+	seg.f = f
+	q.segments = append(q.segments, seg)
+	q.compact()
+	return nil
+}
+
+// Push appends data to the queue.
+func (q *DiskQueue) Push(data []byte) (uint64, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return 0, ErrQueueClosed
+	}
+	if seg := q.active(); seg.size >= q.opts.SegmentSize {
+		if err := q.roll(); err != nil {
+			return 0, err
+		}
+	}
+
+	seg := q.active()
+	id := q.nextID
+	record := make([]byte, diskHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record[4:], uint32(len(data)))
+	binary.BigEndian.PutUint64(record[8:], id)
+	copy(record[diskHeaderSize:], data)
+	binary.BigEndian.PutUint32(record, crc32.ChecksumIEEE(record[8:]))
+	_, err := seg.f.Write(record)
+	if err == nil && q.opts.Sync {
+		err = seg.f.Sync()
+	}
+	if err != nil {
+		// Cut off what was written so that the segment stays readable and
+		// the failed value is not delivered after a restart.
+		seg.f.Truncate(seg.size)
+		return 0, err
+	}
+
+	q.ready.Push(diskRef{id: id, seg: seg, offset: seg.size + diskHeaderSize, size: len(data)})
+	q.nextID++
+	seg.last = id
+	seg.size += int64(len(record))
+	seg.unacked++
+	return id, nil
+}
+
+// Pop delivers the oldest value not delivered yet, ok is false when there is
+// none. The value stays in the queue until acked.
+func (q *DiskQueue) Pop() (msg DiskMessage, ok bool, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return msg, false, ErrQueueClosed
+	}
+	ref, ok := q.ready.Pop()
+	if !ok {
+		return msg, false, nil
+	}
+	data := make([]byte, ref.size)
+	if _, err := ref.seg.f.ReadAt(data, ref.offset); err != nil {
+		q.ready.PushFront(ref)
+		return msg, false, err
+	}
+	q.inflight[ref.id] = ref
+	return DiskMessage{ID: ref.id, Data: data}, true, nil
+}
+
+// Ack removes the delivered value id from the queue for good.
+func (q *DiskQueue) Ack(id uint64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	ref, ok := q.inflight[id]
+	if !ok {
+		return fmt.Errorf("Message %d is not in flight.", id)
+	}
+	var record [8]byte
+	binary.BigEndian.PutUint64(record[:], id)
+	if _, err := q.acks.Write(record[:]); err != nil {
+		return err
+	}
+	if q.opts.Sync {
+		if err := q.acks.Sync(); err != nil {
+			return err
+		}
+	}
+	delete(q.inflight, id)
+	q.acked[id] = struct{}{}
+	ref.seg.unacked--
+	if ref.seg.unacked == 0 {
+		q.compact()
+	}
+	return nil
+}
+
+// Nack puts the delivered value id back at the front of the queue.
+func (q *DiskQueue) Nack(id uint64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	ref, ok := q.inflight[id]
+	if !ok {
+		return fmt.Errorf("Message %d is not in flight.", id)
+	}
+	delete(q.inflight, id)
+	q.ready.PushFront(ref)
+	return nil
+}
+
+// compact deletes the fully acked segments before the active one and
+// rewrites the ack log without their ids.
+func (q *DiskQueue) compact() {
+	n := 0
+	for n < len(q.segments)-1 && q.segments[n].unacked == 0 {
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	for _, seg := range q.segments[:n] {
+		seg.f.Close()
+		os.Remove(seg.path)
+		for id := seg.first; id <= seg.last; id++ {
+			delete(q.acked, id)
+		}
+	}
+	q.segments = append([]*diskSegment(nil), q.segments[n:]...)
+	q.rewriteAcks()
+}
+
+// rewriteAcks replaces the ack log by one holding only the acked ids of the
+// live segments. Failing to do so only leaves stale ids behind.
+func (q *DiskQueue) rewriteAcks() {
+	ids := make([]uint64, 0, len(q.acked))
+	for id := range q.acked {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	data := make([]byte, 8*len(ids))
+	for i, id := range ids {
+		binary.BigEndian.PutUint64(data[8*i:], id)
+	}
+
+	path := filepath.Join(q.dir, diskAckLog)
+	tmp := path + ".tmp"
+	if err := writeSynced(tmp, data); err != nil {
+		return
+	}
+	if err := file.Mv(tmp, path); err != nil {
+		return
+	}
+	syncDir(q.dir)
+	acks, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return
+	}
+	q.acks.Close()
+	q.acks = acks
+}
+
+// writeSynced writes data to a new file at path and flushes it to disk, so
+// that it can be renamed over an older file without risking an empty one.
+func writeSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// syncDir flushes the entries of dir to disk, making the files created or
+// renamed in it survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if e := d.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Len returns the number of values waiting to be delivered.
+func (q *DiskQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.ready.Len()
+}
+
+// InFlight returns the number of values delivered but not acked yet.
+func (q *DiskQueue) InFlight() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.inflight)
+}
+
+// Close flushes and closes the files. Values in flight are delivered again
+// when the queue is reopened.
+func (q *DiskQueue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.closed {
+		return nil
+	}
+	q.closed = true
+	var err error
+	for _, seg := range q.segments {
+		if e := seg.f.Sync(); e != nil && err == nil {
+			err = e
+		}
+		seg.f.Close()
+	}
+	if q.acks != nil {
+		if e := q.acks.Sync(); e != nil && err == nil {
+			err = e
+		}
+		q.acks.Close()
+	}
+	return err
+}
@@ -0,0 +1,91 @@
+package container
+
+// MultiMap maps a key to several values, kept in insertion order. It is not
+// safe for concurrent use.
+type MultiMap[K comparable, V comparable] struct {
+	m   map[K][]V
+	len int
+}
+
+func NewMultiMap[K comparable, V comparable]() *MultiMap[K, V] {
+	return &MultiMap[K, V]{m: make(map[K][]V)}
+}
+
+// Put appends values to key.
+func (m *MultiMap[K, V]) Put(key K, values ...V) {
+	if len(values) == 0 {
+		return
+	}
+	m.m[key] = append(m.m[key], values...)
+	m.len += len(values)
+}
+
+// Get returns the values of key, which the caller must not modify.
+func (m *MultiMap[K, V]) Get(key K) []V {
+	return m.m[key]
+}
+
+func (m *MultiMap[K, V]) Contains(key K, value V) bool {
+	for _, v := range m.m[key] {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove deletes the first occurrence of value from key, reporting whether
+// there was one.
+func (m *MultiMap[K, V]) Remove(key K, value V) bool {
+	values := m.m[key]
+	for i, v := range values {
+		if v == value {
+			if len(values) == 1 {
+				delete(m.m, key)
+			} else {
+				m.m[key] = append(values[:i:i], values[i+1:]...)
+			}
+			m.len--
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveAll deletes key, returning its values.
+func (m *MultiMap[K, V]) RemoveAll(key K) []V {
+	values := m.m[key]
+	delete(m.m, key)
+	m.len -= len(values)
+	return values
+}
+
+// Len returns the number of values under all keys.
+func (m *MultiMap[K, V]) Len() int {
+	return m.len
+}
+
+// Keys returns the keys in no particular order.
+func (m *MultiMap[K, V]) Keys() []K {
+	keys := make([]K, 0, len(m.m))
+	for k := range m.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// All calls yield on every key and value until it returns false.
+func (m *MultiMap[K, V]) All(yield func(key K, value V) bool) {
+	for k, values := range m.m {
+		for _, v := range values {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func (m *MultiMap[K, V]) Clear() {
+	m.m = make(map[K][]V)
+	m.len = 0
+}
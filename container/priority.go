@@ -0,0 +1,236 @@
+package container
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+)
+
+type PriorityOrder int
+
+const (
+	// MinFirst pops the lowest priority first.
+	MinFirst PriorityOrder = iota
+	// MaxFirst pops the highest priority first.
+	MaxFirst
+)
+
+// PriorityItem is the handle of a value pushed to a PriorityQueue, used to
+// update its priority or remove it.
+type PriorityItem[T any] struct {
+	value    T
+	priority int64
+	seq      uint64
+	// index is the position in the heap, -1 once popped or removed.
+	index int
+}
+
+func (i *PriorityItem[T]) Value() T {
+	return i.value
+}
+
+func (i *PriorityItem[T]) Priority() int64 {
+	return i.priority
+}
+
+type priorityHeap[T any] struct {
+	order PriorityOrder
+	items []*PriorityItem[T]
+}
+
+func (h *priorityHeap[T]) Len() int {
+	return len(h.items)
+}
+
+// Less breaks ties on the push order so that equal priorities come out FIFO.
+func (h *priorityHeap[T]) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if a.priority == b.priority {
+		return a.seq < b.seq
+	}
+	if h.order == MaxFirst {
+		return a.priority > b.priority
+	}
+	return a.priority < b.priority
+}
+
+func (h *priorityHeap[T]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *priorityHeap[T]) Push(x interface{}) {
+	item := x.(*PriorityItem[T])
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *priorityHeap[T]) Pop() interface{} {
+	n := len(h.items) - 1
+	item := h.items[n]
+	h.items[n] = nil
+	h.items = h.items[:n]
+	item.index = -1
+	return item
+}
+
+// PriorityQueue pops values by priority. It is not safe for concurrent use,
+// see BlockingPriorityQueue.
+type PriorityQueue[T any] struct {
+	h   priorityHeap[T]
+	seq uint64
+}
+
+func NewPriorityQueue[T any](order PriorityOrder) *PriorityQueue[T] {
+	return &PriorityQueue[T]{
+		h: priorityHeap[T]{order: order},
+	}
+}
+
+func (q *PriorityQueue[T]) Len() int {
+	return q.h.Len()
+}
+
+func (q *PriorityQueue[T]) Push(v T, priority int64) *PriorityItem[T] {
+	q.seq++
+	item := &PriorityItem[T]{value: v, priority: priority, seq: q.seq}
+	heap.Push(&q.h, item)
+	return item
+}
+
+// Pop removes the value which comes first, ok is false when empty.
+func (q *PriorityQueue[T]) Pop() (v T, priority int64, ok bool) {
+	if q.h.Len() == 0 {
+		return v, 0, false
+	}
+	item := heap.Pop(&q.h).(*PriorityItem[T])
+	return item.value, item.priority, true
+}
+
+// Peek returns the value which comes first without removing it.
+func (q *PriorityQueue[T]) Peek() (v T, priority int64, ok bool) {
+	if q.h.Len() == 0 {
+		return v, 0, false
+	}
+	item := q.h.items[0]
+	return item.value, item.priority, true
+}
+
+func (q *PriorityQueue[T]) contains(item *PriorityItem[T]) bool {
+	return item != nil && item.index >= 0 && item.index < q.h.Len() && q.h.items[item.index] == item
+}
+
+// Update changes the priority of item. It returns false if item is no longer
+// in the queue.
+func (q *PriorityQueue[T]) Update(item *PriorityItem[T], priority int64) bool {
+	if !q.contains(item) {
+		return false
+	}
+	item.priority = priority
+	heap.Fix(&q.h, item.index)
+	return true
+}
+
+// Remove takes item out of the queue. It returns false if item is no longer
+// in the queue.
+func (q *PriorityQueue[T]) Remove(item *PriorityItem[T]) bool {
+	if !q.contains(item) {
+		return false
+	}
+	heap.Remove(&q.h, item.index)
+	return true
+}
+
+// BlockingPriorityQueue is a PriorityQueue safe for concurrent use whose
+// consumers wait for values. Once closed, pushes fail while the values left
+// can still be popped.
+type BlockingPriorityQueue[T any] struct {
+	q       *PriorityQueue[T]
+	mutex   *sync.Mutex
+	closed  bool
+	changed chan struct{}
+}
+
+func NewBlockingPriorityQueue[T any](order PriorityOrder) *BlockingPriorityQueue[T] {
+	return &BlockingPriorityQueue[T]{
+		q:       NewPriorityQueue[T](order),
+		mutex:   &sync.Mutex{},
+		changed: make(chan struct{}),
+	}
+}
+
+func (b *BlockingPriorityQueue[T]) broadcast() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *BlockingPriorityQueue[T]) Push(v T, priority int64) (*PriorityItem[T], error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.closed {
+		return nil, ErrQueueClosed
+	}
+	item := b.q.Push(v, priority)
+	b.broadcast()
+	return item, nil
+}
+
+// Pop removes the value which comes first, waiting for one while the queue
+// is empty. It returns ErrQueueClosed once the queue is closed and empty.
+func (b *BlockingPriorityQueue[T]) Pop(ctx context.Context) (v T, priority int64, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for b.q.Len() == 0 {
+		if b.closed {
+			return v, 0, ErrQueueClosed
+		}
+		changed := b.changed
+		b.mutex.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		b.mutex.Lock()
+		if err != nil {
+			return v, 0, err
+		}
+	}
+	v, priority, _ = b.q.Pop()
+	return v, priority, nil
+}
+
+func (b *BlockingPriorityQueue[T]) TryPop() (v T, priority int64, ok bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.q.Pop()
+}
+
+func (b *BlockingPriorityQueue[T]) Update(item *PriorityItem[T], priority int64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.q.Update(item, priority)
+}
+
+func (b *BlockingPriorityQueue[T]) Remove(item *PriorityItem[T]) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.q.Remove(item)
+}
+
+func (b *BlockingPriorityQueue[T]) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.q.Len()
+}
+
+// Close makes pushes fail and wakes every waiter.
+func (b *BlockingPriorityQueue[T]) Close() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.broadcast()
+	}
+}
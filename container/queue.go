@@ -4,47 +4,128 @@ import (
 	"sync"
 )
 
-type Queue []interface{}
+// Queue is the untyped FIFO kept for compatibility. It is stored in a Deque,
+// so that the space of popped contents is reused or released.
+//
+// Queue used to be a []interface{}: code taking len of it, ranging over it or
+// indexing it must use Len, Pop and At instead, and code building it from a
+// slice literal must Push the contents.
+//
+// Deprecated: use Deque, the generic queue, which needs no type assertions.
+// Push, Len and Clear are the same, Pop also reports whether a value was
+// there instead of returning nil, and At, Peek and All read without popping.
+type Queue struct {
+	d Deque[interface{}]
+}
 
 func (q *Queue) Clear() {
-	*q = []interface{}{}
+	q.d.Clear()
 }
 
 func (q *Queue) Push(n interface{}) {
-	*q = append(*q, n)
+	q.d.Push(n)
 }
 
+// Pop removes and returns the first content, nil when empty.
 func (q *Queue) Pop() interface{} {
-	if len(*q) > 0 {
-		n := (*q)[0]
-		*q = (*q)[1:]
-		return n
-	}
-	return nil
+	n, _ := q.d.Pop()
+	return n
 }
 
 func (q *Queue) Len() int {
-	return len(*q)
+	return q.d.Len()
 }
 
+// At returns the i-th content from the front. It panics if i is out of range.
+func (q *Queue) At(i int) interface{} {
+	return q.d.At(i)
+}
+
+// MtxGroupQueue keeps one FIFO per group, e.g. per tenant. Besides popping
+// from a given group, PopFair serves the groups in turn with deficit
+// round-robin so that a busy group cannot starve the others. A group is
+// removed as soon as it is empty; its weight and capacity are kept.
 type MtxGroupQueue struct {
-	q     map[string]*Queue
+	q     map[string]*Deque[interface{}]
 	mutex *sync.RWMutex
+	// popped is broadcast whenever room may have been made in a group.
+	popped *sync.Cond
+	// order lists the non-empty groups in the order PopFair serves them,
+	// starting from next.
+	order      []string
+	next       int
+	deficit    map[string]int
+	weights    map[string]int
+	capacities map[string]int
 }
 
 func (m *MtxGroupQueue) Init() {
-	m.q = make(map[string]*Queue)
+	m.q = make(map[string]*Deque[interface{}])
 	m.mutex = &sync.RWMutex{}
+	m.popped = sync.NewCond(m.mutex)
+	m.order = nil
+	m.next = 0
+	m.deficit = make(map[string]int)
+	m.weights = make(map[string]int)
+	m.capacities = make(map[string]int)
 }
 
+// SetWeight lets PopFair take up to weight contents in a row from grp, 1 by
+// default.
+func (m *MtxGroupQueue) SetWeight(grp string, weight int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if weight < 1 {
+		weight = 1
+	}
+	m.weights[grp] = weight
+}
+
+// SetCapacity limits grp to capacity contents, 0 meaning no limit. Push
+// waits for room in a full group while TryPush fails.
+func (m *MtxGroupQueue) SetCapacity(grp string, capacity int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.capacities[grp] = capacity
+	m.popped.Broadcast()
+}
+
+// Push adds ctnt to grp, waiting for room while grp is at capacity.
 func (m *MtxGroupQueue) Push(grp string, ctnt interface{}) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	_, ok := m.q[grp]
+	for m.fullLocked(grp) {
+		m.popped.Wait()
+	}
+	m.pushLocked(grp, ctnt)
+}
+
+// TryPush adds ctnt to grp, failing with ErrQueueFull when grp is at
+// capacity.
+func (m *MtxGroupQueue) TryPush(grp string, ctnt interface{}) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.fullLocked(grp) {
+		return ErrQueueFull
+	}
+	m.pushLocked(grp, ctnt)
+	return nil
+}
+
+func (m *MtxGroupQueue) fullLocked(grp string) bool {
+	c := m.capacities[grp]
+	q, ok := m.q[grp]
+	return c > 0 && ok && q.Len() >= c
+}
+
+func (m *MtxGroupQueue) pushLocked(grp string, ctnt interface{}) {
+	q, ok := m.q[grp]
 	if !ok {
-		m.q[grp] = new(Queue)
+		q = new(Deque[interface{}])
+		m.q[grp] = q
+		m.order = append(m.order, grp)
 	}
-	m.q[grp].Push(ctnt)
+	q.Push(ctnt)
 }
 
 func (m *MtxGroupQueue) Pop(grp string) interface{} {
@@ -52,11 +133,65 @@ func (m *MtxGroupQueue) Pop(grp string) interface{} {
 	defer m.mutex.Unlock()
 	c, ok := m.q[grp]
 	if ok && c != nil {
-		return c.Pop()
+		ctnt, _ := c.Pop()
+		m.popped.Broadcast()
+		if c.Len() == 0 {
+			m.removeLocked(grp)
+		}
+		return ctnt
 	}
 	return nil
 }
 
+// PopFair pops from the group whose turn it is, ok is false when every group
+// is empty.
+func (m *MtxGroupQueue) PopFair() (grp string, ctnt interface{}, ok bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.order) == 0 {
+		return "", nil, false
+	}
+	if m.next >= len(m.order) {
+		m.next = 0
+	}
+	grp = m.order[m.next]
+	if m.deficit[grp] <= 0 {
+		m.deficit[grp] += m.weight(grp)
+	}
+	q := m.q[grp]
+	ctnt, _ = q.Pop()
+	m.popped.Broadcast()
+	m.deficit[grp]--
+	if q.Len() == 0 {
+		m.removeLocked(grp)
+	} else if m.deficit[grp] <= 0 {
+		m.next++
+	}
+	return grp, ctnt, true
+}
+
+func (m *MtxGroupQueue) weight(grp string) int {
+	if w, ok := m.weights[grp]; ok {
+		return w
+	}
+	return 1
+}
+
+// removeLocked drops grp, keeping the turn on the group that followed it.
+func (m *MtxGroupQueue) removeLocked(grp string) {
+	delete(m.q, grp)
+	delete(m.deficit, grp)
+	for i, g := range m.order {
+		if g == grp {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			if i < m.next {
+				m.next--
+			}
+			break
+		}
+	}
+}
+
 func (m *MtxGroupQueue) Groups() []string {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -73,20 +208,31 @@ func (m *MtxGroupQueue) GroupsLen() int {
 	return len(m.q)
 }
 
+// Len returns the number of contents in grp, 0 for an unknown group.
 func (m *MtxGroupQueue) Len(grp string) int {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
-	return m.q[grp].Len()
+	if q, ok := m.q[grp]; ok {
+		return q.Len()
+	}
+	return 0
 }
 
 func (m *MtxGroupQueue) Clear(grp string) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	m.q[grp].Clear()
+	if _, ok := m.q[grp]; ok {
+		m.removeLocked(grp)
+		m.popped.Broadcast()
+	}
 }
 
 func (m *MtxGroupQueue) ClearAll() {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
-	m.q = make(map[string]*Queue)
+	m.q = make(map[string]*Deque[interface{}])
+	m.order = nil
+	m.next = 0
+	m.deficit = make(map[string]int)
+	m.popped.Broadcast()
 }
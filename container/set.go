@@ -0,0 +1,116 @@
+package container
+
+// Set is an unordered set of comparable values. It is not safe for
+// concurrent use.
+type Set[T comparable] struct {
+	m map[T]struct{}
+}
+
+func NewSet[T comparable](items ...T) *Set[T] {
+	s := &Set[T]{m: make(map[T]struct{}, len(items))}
+	s.Add(items...)
+	return s
+}
+
+func (s *Set[T]) Add(items ...T) {
+	for _, item := range items {
+		s.m[item] = struct{}{}
+	}
+}
+
+// Remove deletes item, reporting whether it was there.
+func (s *Set[T]) Remove(item T) bool {
+	_, ok := s.m[item]
+	delete(s.m, item)
+	return ok
+}
+
+func (s *Set[T]) Contains(item T) bool {
+	_, ok := s.m[item]
+	return ok
+}
+
+func (s *Set[T]) Len() int {
+	return len(s.m)
+}
+
+func (s *Set[T]) Clear() {
+	s.m = make(map[T]struct{})
+}
+
+// Items returns the values in no particular order.
+func (s *Set[T]) Items() []T {
+	items := make([]T, 0, len(s.m))
+	for item := range s.m {
+		items = append(items, item)
+	}
+	return items
+}
+
+// All calls yield on every value until it returns false.
+func (s *Set[T]) All(yield func(item T) bool) {
+	for item := range s.m {
+		if !yield(item) {
+			return
+		}
+	}
+}
+
+func (s *Set[T]) Clone() *Set[T] {
+	c := &Set[T]{m: make(map[T]struct{}, len(s.m))}
+	for item := range s.m {
+		c.m[item] = struct{}{}
+	}
+	return c
+}
+
+// Union returns a new set of the values in s or o.
+func (s *Set[T]) Union(o *Set[T]) *Set[T] {
+	u := s.Clone()
+	for item := range o.m {
+		u.m[item] = struct{}{}
+	}
+	return u
+}
+
+// Intersect returns a new set of the values in both s and o.
+func (s *Set[T]) Intersect(o *Set[T]) *Set[T] {
+	small, large := s, o
+	if small.Len() > large.Len() {
+		small, large = large, small
+	}
+	i := NewSet[T]()
+	for item := range small.m {
+		if large.Contains(item) {
+			i.m[item] = struct{}{}
+		}
+	}
+	return i
+}
+
+// Diff returns a new set of the values in s but not in o.
+func (s *Set[T]) Diff(o *Set[T]) *Set[T] {
+	d := NewSet[T]()
+	for item := range s.m {
+		if !o.Contains(item) {
+			d.m[item] = struct{}{}
+		}
+	}
+	return d
+}
+
+func (s *Set[T]) SubsetOf(o *Set[T]) bool {
+	if s.Len() > o.Len() {
+		return false
+	}
+	for item := range s.m {
+		if !o.Contains(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Set[T]) Equal(o *Set[T]) bool {
+	return s.Len() == o.Len() && s.SubsetOf(o)
+}
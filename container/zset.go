@@ -0,0 +1,465 @@
+package container
+
+import (
+	"math"
+	"math/rand"
+)
+
+const skipMaxLevel = 32
+
+// ZMember is a member of a SortedSet with its score.
+type ZMember struct {
+	Member string
+	Score  int64
+}
+
+// ScoreRange bounds the scores of a range query, inclusive unless the
+// matching Exclusive flag is set.
+type ScoreRange struct {
+	Min, Max                   int64
+	MinExclusive, MaxExclusive bool
+}
+
+// AllScores is the -inf +inf range.
+var AllScores = ScoreRange{Min: math.MinInt64, Max: math.MaxInt64}
+
+func (r ScoreRange) aboveMin(score int64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) belowMax(score int64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+type skipLevel struct {
+	next *skipNode
+	// span is the number of nodes next is ahead of this one.
+	span int
+}
+
+type skipNode struct {
+	member string
+	score  int64
+	back   *skipNode
+	levels []skipLevel
+}
+
+// before reports whether n sorts before the score and member.
+func (n *skipNode) before(score int64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// SortedSet is an in-memory equivalent of a Redis or SSDB zset: members
+// ordered by score, then by member, with rank and score range queries in
+// logarithmic time. Ranks start at 0 and negative ranks count from the end
+// as in Redis. It is not safe for concurrent use.
+type SortedSet struct {
+	head    *skipNode
+	tail    *skipNode
+	level   int
+	members map[string]*skipNode
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		head:    &skipNode{levels: make([]skipLevel, skipMaxLevel)},
+		level:   1,
+		members: make(map[string]*skipNode),
+	}
+}
+
+func (z *SortedSet) Len() int {
+	return len(z.members)
+}
+
+func skipRandomLevel() int {
+	level := 1
+	for level < skipMaxLevel && rand.Intn(4) == 0 {
+		level++
+	}
+	return level
+}
+
+func (z *SortedSet) insert(member string, score int64) {
+	var update [skipMaxLevel]*skipNode
+	var rank [skipMaxLevel]int
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		if i < z.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].next != nil && x.levels[i].next.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].next
+		}
+		update[i] = x
+	}
+	level := skipRandomLevel()
+	if level > z.level {
+		for i := z.level; i < level; i++ {
+			update[i] = z.head
+			z.head.levels[i].span = len(z.members)
+		}
+		z.level = level
+	}
+	n := &skipNode{member: member, score: score, levels: make([]skipLevel, level)}
+	for i := 0; i < level; i++ {
+		n.levels[i].next = update[i].levels[i].next
+		update[i].levels[i].next = n
+		n.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < z.level; i++ {
+		update[i].levels[i].span++
+	}
+	if update[0] != z.head {
+		n.back = update[0]
+	}
+	if n.levels[0].next != nil {
+		n.levels[0].next.back = n
+	} else {
+		z.tail = n
+	}
+	z.members[member] = n
+}
+
+// unlink removes x given the nodes before it on every level.
+func (z *SortedSet) unlink(x *skipNode, update []*skipNode) {
+	for i := 0; i < z.level; i++ {
+		if update[i].levels[i].next == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].next = x.levels[i].next
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].next != nil {
+		x.levels[0].next.back = x.back
+	} else {
+		z.tail = x.back
+	}
+	for z.level > 1 && z.head.levels[z.level-1].next == nil {
+		z.level--
+	}
+	delete(z.members, x.member)
+}
+
+func (z *SortedSet) remove(n *skipNode) {
+	update := make([]*skipNode, skipMaxLevel)
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && x.levels[i].next.before(n.score, n.member) {
+			x = x.levels[i].next
+		}
+		update[i] = x
+	}
+	z.unlink(n, update)
+}
+
+// Set adds member with score or moves it to score, like ZADD. It reports
+// whether member is new.
+func (z *SortedSet) Set(member string, score int64) bool {
+	n, ok := z.members[member]
+	if ok {
+		if n.score == score {
+			return false
+		}
+		z.remove(n)
+	}
+	z.insert(member, score)
+	return !ok
+}
+
+// Incr adds by to the score of member, starting from 0 when it is new, and
+// returns the new score, like ZINCRBY.
+func (z *SortedSet) Incr(member string, by int64) int64 {
+	score := by
+	if n, ok := z.members[member]; ok {
+		score += n.score
+	}
+	z.Set(member, score)
+	return score
+}
+
+func (z *SortedSet) Get(member string) (int64, bool) {
+	if n, ok := z.members[member]; ok {
+		return n.score, true
+	}
+	return 0, false
+}
+
+func (z *SortedSet) Exists(member string) bool {
+	_, ok := z.members[member]
+	return ok
+}
+
+func (z *SortedSet) Delete(member string) bool {
+	n, ok := z.members[member]
+	if ok {
+		z.remove(n)
+	}
+	return ok
+}
+
+func (z *SortedSet) Clear() {
+	*z = *NewSortedSet()
+}
+
+// Rank returns the position of member in ascending order, like ZRANK.
+func (z *SortedSet) Rank(member string) (int, bool) {
+	n, ok := z.members[member]
+	if !ok {
+		return 0, false
+	}
+	rank := 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && !n.before(x.levels[i].next.score, x.levels[i].next.member) {
+			rank += x.levels[i].span
+			x = x.levels[i].next
+		}
+	}
+	return rank - 1, true
+}
+
+// RevRank returns the position of member in descending order, like ZREVRANK.
+func (z *SortedSet) RevRank(member string) (int, bool) {
+	rank, ok := z.Rank(member)
+	if !ok {
+		return 0, false
+	}
+	return len(z.members) - 1 - rank, true
+}
+
+// byRank returns the node at the 1-based rank.
+func (z *SortedSet) byRank(rank int) *skipNode {
+	traversed := 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].next
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
+
+// ranks resolves Redis style start and stop ranks, reporting false for an
+// empty range.
+func (z *SortedSet) ranks(start, stop int) (int, int, bool) {
+	n := len(z.members)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return start, stop, start <= stop && start < n
+}
+
+func (z *SortedSet) collect(x *skipNode, count int, reverse bool) []ZMember {
+	members := []ZMember{}
+	for ; x != nil && count != 0; count-- {
+		members = append(members, ZMember{Member: x.member, Score: x.score})
+		if reverse {
+			x = x.back
+		} else {
+			x = x.levels[0].next
+		}
+	}
+	return members
+}
+
+// RangeByRank returns the members from rank start to stop inclusive in
+// ascending order, like ZRANGE.
+func (z *SortedSet) RangeByRank(start, stop int) []ZMember {
+	start, stop, ok := z.ranks(start, stop)
+	if !ok {
+		return []ZMember{}
+	}
+	return z.collect(z.byRank(start+1), stop-start+1, false)
+}
+
+// RevRangeByRank returns the members from rank start to stop inclusive in
+// descending order, like ZREVRANGE.
+func (z *SortedSet) RevRangeByRank(start, stop int) []ZMember {
+	start, stop, ok := z.ranks(start, stop)
+	if !ok {
+		return []ZMember{}
+	}
+	return z.collect(z.byRank(len(z.members)-start), stop-start+1, true)
+}
+
+// Range returns limit members from offset in ascending order, like the SSDB
+// zrange.
+func (z *SortedSet) Range(offset, limit int) []ZMember {
+	if offset < 0 || limit <= 0 {
+		return []ZMember{}
+	}
+	return z.RangeByRank(offset, offset+limit-1)
+}
+
+// RevRange returns limit members from offset in descending order, like the
+// SSDB zrrange.
+func (z *SortedSet) RevRange(offset, limit int) []ZMember {
+	if offset < 0 || limit <= 0 {
+		return []ZMember{}
+	}
+	return z.RevRangeByRank(offset, offset+limit-1)
+}
+
+// first returns the lowest node in r.
+func (z *SortedSet) first(r ScoreRange) *skipNode {
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && !r.aboveMin(x.levels[i].next.score) {
+			x = x.levels[i].next
+		}
+	}
+	x = x.levels[0].next
+	if x == nil || !r.belowMax(x.score) {
+		return nil
+	}
+	return x
+}
+
+// last returns the highest node in r.
+func (z *SortedSet) last(r ScoreRange) *skipNode {
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && r.belowMax(x.levels[i].next.score) {
+			x = x.levels[i].next
+		}
+	}
+	if x == z.head || !r.aboveMin(x.score) {
+		return nil
+	}
+	return x
+}
+
+func (z *SortedSet) rangeByScore(r ScoreRange, offset, limit int, reverse bool) []ZMember {
+	x := z.first(r)
+	if reverse {
+		x = z.last(r)
+	}
+	if x == nil || offset < 0 {
+		return []ZMember{}
+	}
+	if offset > 0 {
+		rank, _ := z.Rank(x.member)
+		if reverse {
+			rank -= offset
+		} else {
+			rank += offset
+		}
+		if rank < 0 || rank >= len(z.members) {
+			return []ZMember{}
+		}
+		x = z.byRank(rank + 1)
+	}
+	members := []ZMember{}
+	for ; x != nil && limit != 0 && r.aboveMin(x.score) && r.belowMax(x.score); limit-- {
+		members = append(members, ZMember{Member: x.member, Score: x.score})
+		if reverse {
+			x = x.back
+		} else {
+			x = x.levels[0].next
+		}
+	}
+	return members
+}
+
+// RangeByScore returns up to limit members in r from offset in ascending
+// order, like ZRANGEBYSCORE with LIMIT. A negative limit returns them all.
+func (z *SortedSet) RangeByScore(r ScoreRange, offset, limit int) []ZMember {
+	return z.rangeByScore(r, offset, limit, false)
+}
+
+// RevRangeByScore is RangeByScore in descending order, like
+// ZREVRANGEBYSCORE.
+func (z *SortedSet) RevRangeByScore(r ScoreRange, offset, limit int) []ZMember {
+	return z.rangeByScore(r, offset, limit, true)
+}
+
+// Count returns the number of members in r, like ZCOUNT.
+func (z *SortedSet) Count(r ScoreRange) int {
+	first, last := z.first(r), z.last(r)
+	if first == nil || last == nil {
+		return 0
+	}
+	from, _ := z.Rank(first.member)
+	to, _ := z.Rank(last.member)
+	return to - from + 1
+}
+
+// RemoveRangeByRank removes the members from rank start to stop inclusive,
+// like ZREMRANGEBYRANK, and returns how many it removed.
+func (z *SortedSet) RemoveRangeByRank(start, stop int) int {
+	start, stop, ok := z.ranks(start, stop)
+	if !ok {
+		return 0
+	}
+	update := make([]*skipNode, skipMaxLevel)
+	traversed := 0
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && traversed+x.levels[i].span <= start {
+			traversed += x.levels[i].span
+			x = x.levels[i].next
+		}
+		update[i] = x
+	}
+	x = x.levels[0].next
+	removed := 0
+	for ; x != nil && removed <= stop-start; removed++ {
+		next := x.levels[0].next
+		z.unlink(x, update)
+		x = next
+	}
+	return removed
+}
+
+// RemoveRangeByScore removes the members in r, like ZREMRANGEBYSCORE, and
+// returns how many it removed.
+func (z *SortedSet) RemoveRangeByScore(r ScoreRange) int {
+	update := make([]*skipNode, skipMaxLevel)
+	x := z.head
+	for i := z.level - 1; i >= 0; i-- {
+		for x.levels[i].next != nil && !r.aboveMin(x.levels[i].next.score) {
+			x = x.levels[i].next
+		}
+		update[i] = x
+	}
+	x = x.levels[0].next
+	removed := 0
+	for ; x != nil && r.belowMax(x.score); removed++ {
+		next := x.levels[0].next
+		z.unlink(x, update)
+		x = next
+	}
+	return removed
+}
+
+// All calls yield on every member in ascending order until it returns false.
+func (z *SortedSet) All(yield func(member string, score int64) bool) {
+	for x := z.head.levels[0].next; x != nil; x = x.levels[0].next {
+		if !yield(x.member, x.score) {
+			return
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package date
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// day is a calendar date, independent of any time zone.
+type day struct {
+	year  int
+	month time.Month
+	day   int
+}
+
+// Calendar tells business days from weekends and holidays in a location.
+// Dates are taken in that location whatever the location of the times
+// passed in, and results are the start of the day there. It is safe for
+// concurrent use.
+type Calendar struct {
+	loc      *time.Location
+	weekend  map[time.Weekday]bool
+	holidays map[day]string
+	mutex    *sync.RWMutex
+}
+
+// NewCalendar creates a calendar for loc, UTC when nil, with Saturday and
+// Sunday as weekend and no holidays.
+func NewCalendar(loc *time.Location) *Calendar {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Calendar{
+		loc:      loc,
+		weekend:  map[time.Weekday]bool{time.Saturday: true, time.Sunday: true},
+		holidays: make(map[day]string),
+		mutex:    &sync.RWMutex{},
+	}
+}
+
+func (c *Calendar) Location() *time.Location {
+	return c.loc
+}
+
+func (c *Calendar) dayOf(t time.Time) day {
+	y, m, d := t.In(c.loc).Date()
+	return day{y, m, d}
+}
+
+func (c *Calendar) start(d day) time.Time {
+	return wallClock(d.year, d.month, d.day, 0, 0, 0, 0, c.loc)
+}
+
+// addDays moves d by n calendar days.
+func addDays(d day, n int) day {
+	y, m, dd := time.Date(d.year, d.month, d.day+n, 12, 0, 0, 0, time.UTC).Date()
+	return day{y, m, dd}
+}
+
+func weekday(d day) time.Weekday {
+	return time.Date(d.year, d.month, d.day, 12, 0, 0, 0, time.UTC).Weekday()
+}
+
+// SetWeekend replaces the weekend days.
+func (c *Calendar) SetWeekend(days ...time.Weekday) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.weekend = make(map[time.Weekday]bool)
+	for _, d := range days {
+		c.weekend[d] = true
+	}
+}
+
+// AddHoliday makes the date of t in the calendar location a holiday.
+func (c *Calendar) AddHoliday(t time.Time, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.holidays[c.dayOf(t)] = name
+}
+
+func (c *Calendar) addHoliday(d day, name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.holidays[d] = name
+}
+
+func (c *Calendar) RemoveHoliday(t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.holidays, c.dayOf(t))
+}
+
+// Holiday returns the name of the holiday on the date of t, if any.
+func (c *Calendar) Holiday(t time.Time) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	name, ok := c.holidays[c.dayOf(t)]
+	return name, ok
+}
+
+func (c *Calendar) isBusinessDay(d day) bool {
+	if c.weekend[weekday(d)] {
+		return false
+	}
+	_, ok := c.holidays[d]
+	return !ok
+}
+
+// IsBusinessDay reports whether the date of t is neither a weekend day nor
+// a holiday.
+func (c *Calendar) IsBusinessDay(t time.Time) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.isBusinessDay(c.dayOf(t))
+}
+
+// step returns the business day n business days away from d, moving one
+// day at a time. It gives up after ten years without a business day.
+func (c *Calendar) step(d day, n int) (day, error) {
+	dir := 1
+	if n < 0 {
+		dir, n = -1, -n
+	}
+	for skipped := 0; n > 0; {
+		d = addDays(d, dir)
+		if c.isBusinessDay(d) {
+			n--
+			skipped = 0
+		} else if skipped++; skipped > 3660 {
+			return d, fmt.Errorf("Calendar has no business day.")
+		}
+	}
+	return d, nil
+}
+
+// NextBusinessDay returns the start of the first business day after the
+// date of t.
+func (c *Calendar) NextBusinessDay(t time.Time) (time.Time, error) {
+	return c.AddBusinessDays(t, 1)
+}
+
+// PrevBusinessDay returns the start of the last business day before the
+// date of t.
+func (c *Calendar) PrevBusinessDay(t time.Time) (time.Time, error) {
+	return c.AddBusinessDays(t, -1)
+}
+
+// AddBusinessDays returns the start of the nth business day after the date
+// of t, or before it when n is negative. When n is 0 it returns the start
+// of the date of t, business day or not.
+func (c *Calendar) AddBusinessDays(t time.Time, n int) (time.Time, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	d, err := c.step(c.dayOf(t), n)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return c.start(d), nil
+}
+
+// BusinessDaysBetween counts the business days from the date of from
+// included to the date of to excluded, negated when to is before from.
+func (c *Calendar) BusinessDaysBetween(from, to time.Time) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	d, end := c.dayOf(from), c.dayOf(to)
+	sign := 1
+	if c.start(end).Before(c.start(d)) {
+		d, end, sign = end, d, -1
+	}
+	n := 0
+	for ; d != end; d = addDays(d, 1) {
+		if c.isBusinessDay(d) {
+			n++
+		}
+	}
+	return sign * n
+}
+
+type jsonHoliday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// LoadJSON adds the holidays of a JSON list like
+// [{"date": "2024-01-01", "name": "New Year"}].
+func (c *Calendar) LoadJSON(r io.Reader) error {
+	holidays := []jsonHoliday{}
+	if err := json.NewDecoder(r).Decode(&holidays); err != nil {
+		return err
+	}
+	for _, h := range holidays {
+		t, err := time.Parse("2006-01-02", h.Date)
+		if err != nil {
+			return fmt.Errorf("Invalid holiday date %q.", h.Date)
+		}
+		c.addHoliday(day{t.Year(), t.Month(), t.Day()}, h.Name)
+	}
+	return nil
+}
+
+// parseICalDate reads the date of a DTSTART or DTEND value, either a date
+// or a date-time of which only the date is kept.
+func parseICalDate(value string) (day, error) {
+	if len(value) < 8 {
+		return day{}, fmt.Errorf("Invalid iCalendar date %q.", value)
+	}
+	t, err := time.Parse("20060102", value[:8])
+	if err != nil {
+		return day{}, fmt.Errorf("Invalid iCalendar date %q.", value)
+	}
+	return day{t.Year(), t.Month(), t.Day()}, nil
+}
+
+// LoadICal adds the holidays of the VEVENTs of an iCalendar file, named
+// after their SUMMARY. Events spanning several days, DTEND excluded, make
+// every one of them a holiday. Recurrence rules are not supported.
+func (c *Calendar) LoadICal(r io.Reader) error {
+	// Unfold the lines continued with a leading space or tab.
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	var start, end *day
+	var name string
+	inEvent := false
+	for _, line := range lines {
+		prop, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		// Drop parameters such as ;VALUE=DATE.
+		prop, _, _ = strings.Cut(strings.ToUpper(prop), ";")
+		switch {
+		case prop == "BEGIN" && value == "VEVENT":
+			inEvent, start, end, name = true, nil, nil, ""
+		case !inEvent:
+		case prop == "DTSTART" || prop == "DTEND":
+			d, err := parseICalDate(value)
+			if err != nil {
+				return err
+			}
+			if prop == "DTSTART" {
+				start = &d
+			} else {
+				end = &d
+			}
+		case prop == "SUMMARY":
+			name = value
+		case prop == "END" && value == "VEVENT":
+			inEvent = false
+			if start == nil {
+				continue
+			}
+			days := 1
+			if end != nil {
+				to := time.Date(end.year, end.month, end.day, 0, 0, 0, 0, time.UTC)
+				from := time.Date(start.year, start.month, start.day, 0, 0, 0, 0, time.UTC)
+				if n := int(to.Sub(from).Hours() / 24); n > 1 {
+					days = n
+				}
+			}
+			for i := 0; i < days; i++ {
+				c.addHoliday(addDays(*start, i), name)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFile adds the holidays of a .ics or .json file.
+func (c *Calendar) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ics", ".ical":
+		return c.LoadICal(f)
+	case ".json":
+		return c.LoadJSON(f)
+	}
+	return fmt.Errorf("Unknown holiday file format %s.", path)
+}
+
+var calendars = struct {
+	m     map[string]*Calendar
+	mutex *sync.RWMutex
+}{
+	m:     make(map[string]*Calendar),
+	mutex: &sync.RWMutex{},
+}
+
+// RegisterCalendar makes c the calendar of location, the name given to
+// DateUnixByLocation such as "Asia/Shanghai".
+func RegisterCalendar(location string, c *Calendar) {
+	calendars.mutex.Lock()
+	defer calendars.mutex.Unlock()
+	calendars.m[location] = c
+}
+
+// CalendarByLocation returns the calendar registered for location. Without
+// one it returns a new calendar with no holidays in that location, or in
+// UTC when the location is unknown as DateUnixByLocation does.
+func CalendarByLocation(location string) *Calendar {
+	calendars.mutex.RLock()
+	c, ok := calendars.m[location]
+	calendars.mutex.RUnlock()
+	if ok {
+		return c
+	}
+	loc, err := time.LoadLocation(location)
+	if err != nil {
+		loc = time.UTC
+	}
+	return NewCalendar(loc)
+}
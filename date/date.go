@@ -24,58 +24,80 @@ func DateDurationFrom(t time.Time) time.Duration {
 	return time.Now().Sub(t)
 }
 
+// DateUnix returns the Unix time of the start of a YYYY-MM-DD date in UTC,
+// see DateUnixIn for other locations.
 func DateUnix(date string) int64 {
-	t, err := time.Parse("2006-01-02", date)
+	return DateUnixIn(date, time.UTC)
+}
+
+// DateMillisecond is DateUnix in milliseconds.
+func DateMillisecond(date string) int64 {
+	return DateMillisecondIn(date, time.UTC)
+}
+
+// DateUnixIn returns the Unix time of the start of a YYYY-MM-DD date in loc,
+// or 0 if the date is invalid.
+func DateUnixIn(date string, loc *time.Location) int64 {
+	t, err := parseDateIn(date, loc)
 	if err != nil {
 		return 0
 	}
 	return t.Unix()
 }
 
-func DateMillisecond(date string) int64 {
-	t, err := time.Parse("2006-01-02", date)
+func DateMillisecondIn(date string, loc *time.Location) int64 {
+	t, err := parseDateIn(date, loc)
 	if err != nil {
 		return 0
 	}
-	return t.UnixNano() / int64(time.Millisecond/time.Nanosecond)
+	return UnixMilli(t)
+}
+
+// parseDateIn is time.ParseInLocation for a date, returning the start of
+// the day even when DST skips its midnight.
+func parseDateIn(date string, loc *time.Location) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return t, err
+	}
+	return wallClock(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
 }
 
 func DateUnixByLocation(date string, location string) int64 {
 	loc, err := time.LoadLocation(location)
-	var t time.Time
-	var pErr error
 	if err != nil {
-		t, pErr = time.Parse("2006-01-02", date)
-	} else {
-		t, pErr = time.ParseInLocation("2006-01-02", date, loc)
-	}
-	if pErr != nil {
-		return 0
+		loc = time.UTC
 	}
-	return t.Unix()
+	return DateUnixIn(date, loc)
 }
 
 func UnixMilli(t time.Time) int64 {
 	return t.UnixNano() / int64(time.Millisecond/time.Nanosecond)
 }
 
+// BeginOfDate returns the start of the day of t in its location.
 func BeginOfDate(t time.Time) time.Time {
-	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return wallClock(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
 }
 
 func Today() time.Time {
-	now := time.Now()
-	return BeginOfDate(now)
+	return TodayIn(time.Local)
+}
+
+func TodayIn(loc *time.Location) time.Time {
+	return BeginOfDate(time.Now().In(loc))
 }
 
 func Yesterday() time.Time {
-	now := time.Now()
-	diff := now.Add(-time.Hour * 24)
-	return BeginOfDate(diff)
+	return DaysBeforeNow(1)
 }
 
 func DaysBeforeNow(days int64) time.Time {
-	now := time.Now()
-	diff := now.Add(-time.Hour * 24 * time.Duration(days))
-	return BeginOfDate(diff)
+	return DaysBeforeNowIn(days, time.Local)
+}
+
+// DaysBeforeNowIn returns the start of the day the given number of calendar
+// days before today in loc. Days are not 24h long across DST changes.
+func DaysBeforeNowIn(days int64, loc *time.Location) time.Time {
+	return AddDays(TodayIn(loc), -int(days))
 }
@@ -0,0 +1,123 @@
+package date
+
+import (
+	"time"
+)
+
+// The helpers below work on calendar dates and wall clock times in the
+// location of their argument, call them with t.In(loc) for another one. The
+// start of a day is its first instant, which is not midnight where clocks
+// skip midnight for DST, and days last 23 or 25 hours across DST changes.
+
+// wallOf returns the wall clock time of t as a UTC time.
+func wallOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+}
+
+// wallClock returns the instant showing the given wall clock time in loc.
+// time.Date does not say which instant it picks when a DST change repeats
+// or skips the time: wallClock picks the first of a repeated time and, for
+// a skipped one, moves it forward by the size of the gap, so that the start
+// of a day is always its first instant.
+func wallClock(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	t := time.Date(year, month, day, hour, min, sec, nsec, loc)
+	requested := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+	if start, _ := t.ZoneBounds(); !start.IsZero() {
+		_, prev := start.Add(-time.Nanosecond).Zone()
+		earlier := requested.Add(-time.Duration(prev) * time.Second).In(loc)
+		if earlier.Before(t) && wallOf(earlier).Equal(requested) {
+			return earlier
+		}
+	}
+	if !wallOf(t).Before(requested) {
+		return t
+	}
+	_, before := t.Zone()
+	_, change := t.ZoneBounds()
+	_, after := change.Zone()
+	return t.Add(time.Duration(after-before) * time.Second)
+}
+
+// AddDays moves t by n calendar days, keeping its wall clock time. A time
+// skipped by a DST change moves forward by the size of the gap.
+func AddDays(t time.Time, n int) time.Time {
+	return wallClock(t.Year(), t.Month(), t.Day()+n, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// DaysIn returns the number of days in month of year.
+func DaysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// AddMonths moves t by n months, keeping its wall clock time and clamping
+// the day to the end of shorter months, so that 31 January plus a month is
+// the last day of February.
+func AddMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	d := t.Day()
+	if last := DaysIn(first.Year(), first.Month()); d > last {
+		d = last
+	}
+	return wallClock(first.Year(), first.Month(), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// AddYears moves t by n years, 29 February becoming 28 February in common
+// years.
+func AddYears(t time.Time, n int) time.Time {
+	return AddMonths(t, 12*n)
+}
+
+// DaysBetween returns the number of calendar days from the date of a to the
+// date of b, each in its own location.
+func DaysBetween(a, b time.Time) int {
+	ua := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	ub := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(ub.Sub(ua).Hours() / 24)
+}
+
+func BeginOfDay(t time.Time) time.Time {
+	return BeginOfDate(t)
+}
+
+// EndOfDay returns the last nanosecond of the day of t.
+func EndOfDay(t time.Time) time.Time {
+	return wallClock(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+// BeginOfWeek returns the start of the week of t, weeks starting on
+// firstDay.
+func BeginOfWeek(t time.Time, firstDay time.Weekday) time.Time {
+	offset := (int(t.Weekday()) - int(firstDay) + 7) % 7
+	return wallClock(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, t.Location())
+}
+
+func EndOfWeek(t time.Time, firstDay time.Weekday) time.Time {
+	begin := BeginOfWeek(t, firstDay)
+	return wallClock(begin.Year(), begin.Month(), begin.Day()+7, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+func BeginOfMonth(t time.Time) time.Time {
+	return wallClock(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func EndOfMonth(t time.Time) time.Time {
+	return wallClock(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+func BeginOfQuarter(t time.Time) time.Time {
+	month := (t.Month()-1)/3*3 + 1
+	return wallClock(t.Year(), month, 1, 0, 0, 0, 0, t.Location())
+}
+
+func EndOfQuarter(t time.Time) time.Time {
+	begin := BeginOfQuarter(t)
+	return wallClock(begin.Year(), begin.Month()+3, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+func BeginOfYear(t time.Time) time.Time {
+	return wallClock(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+}
+
+func EndOfYear(t time.Time) time.Time {
+	return wallClock(t.Year()+1, time.January, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/heqzha/goutils/concurrency"
+)
+
+// cacheStore is where ReadThrough keeps values. get reports a missing key
+// with ok false and no error.
+type cacheStore interface {
+	get(key string) (value string, ok bool, err error)
+	set(key, value string, ttl time.Duration) error
+}
+
+type redisCacheStore struct {
+	handler *RedisHandler
+}
+
+func (s redisCacheStore) get(key string) (string, bool, error) {
+	value, err := redis.String(s.handler.do("GET", key))
+	if err == redis.ErrNil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// set writes the value and its expiry in a single SET, so that a failure
+// cannot leave the key without one.
+func (s redisCacheStore) set(key, value string, ttl time.Duration) error {
+	if ttl <= 0 {
+		_, err := s.handler.do("SET", key, value)
+		return err
+	}
+	ms := int64(ttl / time.Millisecond)
+	if ms < 1 {
+		ms = 1
+	}
+	_, err := s.handler.do("SET", key, value, "PX", ms)
+	return err
+}
+
+type ssdbCacheStore struct {
+	handler *SSDBHandler
+}
+
+// get takes an empty value for a missing key, since that is what SSDB answers
+// for one.
+func (s ssdbCacheStore) get(key string) (string, bool, error) {
+	value, err := s.handler.Get(key)
+	if err != nil {
+		if strings.Contains(err.Error(), "not_found") {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return value, value != "", nil
+}
+
+func (s ssdbCacheStore) set(key, value string, ttl time.Duration) error {
+	return s.handler.SetWithExp(key, value, ttl)
+}
+
+// ReadThrough serves values from a cache and loads the missing ones, letting
+// a single caller per key run the loader while the others wait for its
+// result.
+type ReadThrough struct {
+	store  cacheStore
+	ttl    time.Duration
+	flight *concurrency.Singleflight[string]
+}
+
+// NewRedisReadThrough caches values in Redis for ttl, rounded down to
+// milliseconds, or forever when that is zero.
+func NewRedisReadThrough(h *RedisHandler, ttl time.Duration) *ReadThrough {
+	return &ReadThrough{
+		store:  redisCacheStore{h},
+		ttl:    ttl,
+		flight: concurrency.NewSingleflight[string](),
+	}
+}
+
+// NewSSDBReadThrough caches values in SSDB for ttl, rounded down to seconds.
+func NewSSDBReadThrough(h *SSDBHandler, ttl time.Duration) *ReadThrough {
+	return &ReadThrough{
+		store:  ssdbCacheStore{h},
+		ttl:    ttl,
+		flight: concurrency.NewSingleflight[string](),
+	}
+}
+
+// Get returns the cached value of key, or calls load and caches its result.
+// Failing to read the cache is returned as is, while failing to write it is
+// ignored since the value was loaded anyway.
+func (c *ReadThrough) Get(key string, load func() (string, error)) (string, error) {
+	value, err, _ := c.flight.Do(key, func() (string, error) {
+		value, ok, err := c.store.get(key)
+		if err != nil || ok {
+			return value, err
+		}
+		if value, err = load(); err != nil {
+			return "", err
+		}
+		c.store.set(key, value, c.ttl)
+		return value, nil
+	})
+	return value, err
+}
+
+// Forget makes the next Get of key read the cache again instead of waiting
+// for the load in flight, e.g. after the key was updated.
+func (c *ReadThrough) Forget(key string) {
+	c.flight.Forget(key)
+}
@@ -6,19 +6,66 @@ import (
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	"github.com/heqzha/goutils/concurrency"
 )
 
 type RedisHandler struct {
 	Pool *redis.Pool
+	// Breaker, when set, guards every command, which then fails with
+	// concurrency.ErrCircuitOpen while it is open. Unless the breaker is
+	// configured with IsFailure, error replies from Redis do not count as
+	// failures.
+	Breaker *concurrency.CircuitBreaker
 }
 
-func (h *RedisHandler) do(cmd string, args ...interface{}) (interface{}, error) {
+// isRedisFailure reports whether err means Redis could not be reached, as
+// opposed to an error reply to a command.
+func isRedisFailure(err error) bool {
+	_, replied := err.(redis.Error)
+	return err != nil && !replied
+}
+
+// call runs f on a connection of the pool, through Breaker when set.
+func (h *RedisHandler) call(f func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	var done func(failed bool)
+	if h.Breaker != nil {
+		var err error
+		if done, err = h.Breaker.Allow(); err != nil {
+			return nil, err
+		}
+	}
+
 	conn := h.Pool.Get()
 	defer conn.Close()
 
-	data, err := conn.Do(cmd, args...)
+	data, err := f(conn)
+	if done != nil {
+		done(h.Breaker.IsFailure(err, isRedisFailure))
+	}
+	return data, err
+}
+
+// exec sends a command through call, returning its error as is.
+func (h *RedisHandler) exec(cmd string, args ...interface{}) (interface{}, error) {
+	return h.call(func(conn redis.Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	})
+}
+
+// script runs a Lua script through call.
+func (h *RedisHandler) script(s *redis.Script, keysAndArgs ...interface{}) (interface{}, error) {
+	return h.call(func(conn redis.Conn) (interface{}, error) {
+		return s.Do(conn, keysAndArgs...)
+	})
+}
+
+func (h *RedisHandler) do(cmd string, args ...interface{}) (interface{}, error) {
+	data, err := h.exec(cmd, args...)
+	if err == concurrency.ErrCircuitOpen {
+		return nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("%s args %v: %v", cmd, args, err)
+		return nil, fmt.Errorf("%s args %v: %w", cmd, args, err)
 	}
 	return data, nil
 }
@@ -55,75 +102,51 @@ func (h *RedisHandler) Close() {
 }
 
 func (h *RedisHandler) Ping() error {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	_, err := redis.String(conn.Do("PING"))
+	_, err := redis.String(h.exec("PING"))
 	if err != nil {
-		return fmt.Errorf("cannot 'PING' db: %v", err)
+		return fmt.Errorf("cannot 'PING' db: %w", err)
 	}
 	return nil
 }
 
 func (h *RedisHandler) Get(key string) (string, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	data, err := redis.String(conn.Do("GET", key))
+	data, err := redis.String(h.exec("GET", key))
 	if err != nil {
-		return data, fmt.Errorf("error getting key %s: %v", key, err)
+		return data, fmt.Errorf("error getting key %s: %w", key, err)
 	}
 	return data, nil
 }
 
 func (h *RedisHandler) Set(key string, value string) error {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("SET", key, value)
+	_, err := h.exec("SET", key, value)
 	if err != nil {
 		v := value
 		if len(v) > 15 {
 			v = v[0:12] + "..."
 		}
-		return fmt.Errorf("error setting key %s to %s: %v", key, v, err)
+		return fmt.Errorf("error setting key %s to %s: %w", key, v, err)
 	}
 	return err
 }
 
 func (h *RedisHandler) Exists(key string) (bool, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	ok, err := redis.Bool(conn.Do("EXISTS", key))
+	ok, err := redis.Bool(h.exec("EXISTS", key))
 	if err != nil {
-		return ok, fmt.Errorf("error checking if key %s exists: %v", key, err)
+		return ok, fmt.Errorf("error checking if key %s exists: %w", key, err)
 	}
 	return ok, err
 }
 
 func (h *RedisHandler) Delete(key string) error {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
+	_, err := h.exec("DEL", key)
 	return err
 }
 
 func (h *RedisHandler) GetKeys(pattern string) ([]string, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
 	iter := 0
 	keys := []string{}
 	for {
-		arr, err := redis.Values(conn.Do("SCAN", iter, "MATCH", pattern))
+		arr, err := redis.Values(h.exec("SCAN", iter, "MATCH", pattern))
 		if err != nil {
 			return keys, fmt.Errorf("error retrieving '%s' keys", pattern)
 		}
@@ -141,11 +164,7 @@ func (h *RedisHandler) GetKeys(pattern string) ([]string, error) {
 }
 
 func (h *RedisHandler) Incr(key string) (int, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	return redis.Int(conn.Do("INCR", key))
+	return redis.Int(h.exec("INCR", key))
 }
 
 func (h *RedisHandler) Llen(key string) (int64, error) {
@@ -186,33 +205,27 @@ func (h *RedisHandler) Lrange(key string, offset, limit int) ([]string, error) {
 	}
 	res, err := h.do("LRANGE", key, start, stop)
 	if err != nil {
-		return nil, fmt.Errorf("error lrange key %s %v", key, err)
+		return nil, fmt.Errorf("error lrange key %s %w", key, err)
 	}
 	return h.stringSliceResults(res.([]interface{})), nil
 }
 
 func (h *RedisHandler) Zadd(key string, value string, score int64) error {
-	conn := h.Pool.Get()
-	defer conn.Close()
-	_, err := conn.Do("ZADD", key, score, value)
+	_, err := h.exec("ZADD", key, score, value)
 	if err != nil {
 		v := string(value)
 		if len(v) > 15 {
 			v = v[0:12] + "..."
 		}
-		return fmt.Errorf("error zadd key %s to %s: err  %v", key, v, conn.Err())
+		return fmt.Errorf("error zadd key %s to %s: err  %w", key, v, err)
 	}
 	return err
 }
 
 func (h *RedisHandler) Zcard(key string) (int, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZCARD", key)
+	res, err := h.exec("ZCARD", key)
 	if err != nil {
-		return -1, fmt.Errorf("error zcard key %s %v", key, err)
+		return -1, fmt.Errorf("error zcard key %s %w", key, err)
 	}
 	return int(res.(int64)), nil
 }
@@ -235,135 +248,93 @@ func (h *RedisHandler) mapZrangeResults(ress []interface{}) ([]map[string]int64,
 }
 
 func (h *RedisHandler) Zrange(key string, offset, limit int) ([]map[string]int64, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZRANGE", key, offset, offset*limit+limit, "WITHSCORES")
+	res, err := h.exec("ZRANGE", key, offset, offset*limit+limit, "WITHSCORES")
 	if err != nil {
-		return nil, fmt.Errorf("error zrange key %s %v", key, err)
+		return nil, fmt.Errorf("error zrange key %s %w", key, err)
 	}
 	return h.mapZrangeResults(res.([]interface{}))
 }
 
 func (h *RedisHandler) Zrangebyscore(key string, min, max int64, offset, limit int) ([]map[string]int64, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZRANGEBYSCORE", key, "("+strconv.FormatInt(min, 10), strconv.FormatInt(max, 10), "WITHSCORES", "LIMIT", offset, limit)
+	res, err := h.exec("ZRANGEBYSCORE", key, "("+strconv.FormatInt(min, 10), strconv.FormatInt(max, 10), "WITHSCORES", "LIMIT", offset, limit)
 	if err != nil {
-		return nil, fmt.Errorf("error zrangebyscore key %s %v", key, err)
+		return nil, fmt.Errorf("error zrangebyscore key %s %w", key, err)
 	}
 	return h.mapZrangeResults(res.([]interface{}))
 }
 
 func (h *RedisHandler) ZrangebyscoreInf(key string, offset, limit int) ([]map[string]int64, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZRANGEBYSCORE", key, "-inf", "+inf", "WITHSCORES", "LIMIT", offset, limit)
+	res, err := h.exec("ZRANGEBYSCORE", key, "-inf", "+inf", "WITHSCORES", "LIMIT", offset, limit)
 	if err != nil {
-		return nil, fmt.Errorf("error zrangebyscore key %s %v", key, err)
+		return nil, fmt.Errorf("error zrangebyscore key %s %w", key, err)
 	}
 	return h.mapZrangeResults(res.([]interface{}))
 }
 
 func (h *RedisHandler) Zrevrangebyscore(key string, min, max int64, offset, limit int) ([]map[string]int64, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZREVRANGEBYSCORE", key, strconv.FormatInt(max, 10), "("+strconv.FormatInt(min, 10), "WITHSCORES", "LIMIT", offset, limit)
+	res, err := h.exec("ZREVRANGEBYSCORE", key, strconv.FormatInt(max, 10), "("+strconv.FormatInt(min, 10), "WITHSCORES", "LIMIT", offset, limit)
 	if err != nil {
-		return nil, fmt.Errorf("error zrangebyscore key %s %v", key, err)
+		return nil, fmt.Errorf("error zrangebyscore key %s %w", key, err)
 	}
 	return h.mapZrangeResults(res.([]interface{}))
 }
 
 func (h *RedisHandler) ZrevrangebyscoreInf(key string, offset, limit int) ([]map[string]int64, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZREVRANGEBYSCORE", key, "+inf", "-inf", "WITHSCORES", "LIMIT", offset, limit)
+	res, err := h.exec("ZREVRANGEBYSCORE", key, "+inf", "-inf", "WITHSCORES", "LIMIT", offset, limit)
 	if err != nil {
-		return nil, fmt.Errorf("error zrangebyscore key %s %v", key, err)
+		return nil, fmt.Errorf("error zrangebyscore key %s %w", key, err)
 	}
 	return h.mapZrangeResults(res.([]interface{}))
 }
 
 func (h *RedisHandler) Zcount(key string, min, max int64) (int, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZCOUNT", key, "("+strconv.FormatInt(min, 10), strconv.FormatInt(max, 10))
+	res, err := h.exec("ZCOUNT", key, "("+strconv.FormatInt(min, 10), strconv.FormatInt(max, 10))
 	if err != nil {
-		return -1, fmt.Errorf("error zcount key %s %v", key, err)
+		return -1, fmt.Errorf("error zcount key %s %w", key, err)
 	}
 	return int(res.(int64)), nil
 }
 
 func (h *RedisHandler) ZcountInf(key string) (int, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("ZCOUNT", key, "-inf", "+inf")
+	res, err := h.exec("ZCOUNT", key, "-inf", "+inf")
 	if err != nil {
-		return -1, fmt.Errorf("error zcount key %s %v", key, err)
+		return -1, fmt.Errorf("error zcount key %s %w", key, err)
 	}
 	return int(res.(int64)), nil
 }
 
 func (h *RedisHandler) Zremrangebyrank(key string, start, stop int64) error {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("ZREMRANGEBYRANK", key, start, stop)
+	_, err := h.exec("ZREMRANGEBYRANK", key, start, stop)
 	if err != nil {
-		return fmt.Errorf("error zremrangebyrank key %s :%v", key, err)
+		return fmt.Errorf("error zremrangebyrank key %s :%w", key, err)
 	}
 	return err
 }
 
 func (h *RedisHandler) Zincrby(key string, value string, score int64) error {
-	conn := h.Pool.Get()
-	defer conn.Close()
-	_, err := conn.Do("ZINCRBY", key, score, value)
+	_, err := h.exec("ZINCRBY", key, score, value)
 	if err != nil {
 		v := value
 		if len(v) > 15 {
 			v = v[0:12] + "..."
 		}
-		return fmt.Errorf("error zadd key %s to %s: err  %v", key, v, conn.Err())
+		return fmt.Errorf("error zadd key %s to %s: err  %w", key, v, err)
 	}
 	return err
 }
 
 func (h *RedisHandler) Expire(key string, seconds int64) error {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("EXPIRE", key, seconds)
+	_, err := h.exec("EXPIRE", key, seconds)
 	if err != nil {
-		return fmt.Errorf("error expire key %s to %d: %v", key, seconds, err)
+		return fmt.Errorf("error expire key %s to %d: %w", key, seconds, err)
 	}
 	return err
 }
 
 func (h *RedisHandler) Ttl(key string) (int, error) {
-
-	conn := h.Pool.Get()
-	defer conn.Close()
-
-	res, err := conn.Do("TTL", key)
+	res, err := h.exec("TTL", key)
 	if err != nil {
-		return -1, fmt.Errorf("error ttl key %s %v", key, err)
+		return -1, fmt.Errorf("error ttl key %s %w", key, err)
 	}
 	return int(res.(int64)), nil
 }
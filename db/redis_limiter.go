@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// redisLimiterScript keeps the events of the window in a sorted set scored by
+// the Redis server time in milliseconds, so that every instance shares one
+// clock. It returns 0 when the event is let through, otherwise the number of
+// milliseconds until a slot frees up.
+var redisLimiterScript = redis.NewScript(1, `-- goutils:limiter
+redis.replicate_commands()
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+if redis.call('ZCARD', KEYS[1]) < limit then
+	redis.call('ZADD', KEYS[1], now, ARGV[3])
+	redis.call('PEXPIRE', KEYS[1], window)
+	return 0
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+return math.max(tonumber(oldest[2]) + window - now, 1)
+`)
+
+// RedisLimiter allows at most limit events within any window long period
+// across every process sharing the same Redis key.
+type RedisLimiter struct {
+	handler *RedisHandler
+	key     string
+	limit   int
+	window  time.Duration
+}
+
+// NewLimiter returns a sliding window limiter stored under key. window is
+// rounded to milliseconds.
+func (h *RedisHandler) NewLimiter(key string, limit int, window time.Duration) *RedisLimiter {
+	if window < time.Millisecond {
+		window = time.Millisecond
+	}
+	return &RedisLimiter{
+		handler: h,
+		key:     key,
+		limit:   limit,
+		window:  window,
+	}
+}
+
+// take records an event if the window has room for it, otherwise it returns
+// how long until it has.
+func (l *RedisLimiter) take() (time.Duration, error) {
+	if l.limit <= 0 {
+		return 0, fmt.Errorf("Rate limit of %s cannot be satisfied.", l.key)
+	}
+	ms, err := redis.Int64(l.handler.script(redisLimiterScript, l.key, int64(l.window/time.Millisecond), l.limit, redisToken()))
+	if err != nil {
+		return 0, fmt.Errorf("error limiting key %s: %w", l.key, err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Allow reports whether an event may happen now, recording it if so.
+func (l *RedisLimiter) Allow() (bool, error) {
+	delay, err := l.take()
+	return err == nil && delay == 0, err
+}
+
+// Wait blocks until an event may happen or ctx is done.
+func (l *RedisLimiter) Wait(ctx context.Context) error {
+	for {
+		delay, err := l.take()
+		if err != nil || delay == 0 {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrLockNotHeld is returned when renewing or releasing a lock whose lease
+// has expired or which was never taken.
+var ErrLockNotHeld = fmt.Errorf("Lock is not held.")
+
+var (
+	// redisLockAcquireScript takes the lock and, only if that worked, bumps
+	// the fencing counter so that tokens are handed out in lock order.
+	redisLockAcquireScript = redis.NewScript(2, `-- goutils:lock-acquire
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0
+`)
+	redisLockRenewScript = redis.NewScript(1, `-- goutils:lock-renew
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+	redisLockReleaseScript = redis.NewScript(1, `-- goutils:lock-release
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+var (
+	redisTokenPrefix = func() string {
+		b := make([]byte, 8)
+		rand.Read(b)
+		return hex.EncodeToString(b)
+	}()
+	redisTokenSeq uint64
+)
+
+// redisToken returns an id unique across processes.
+func redisToken() string {
+	return fmt.Sprintf("%s-%d", redisTokenPrefix, atomic.AddUint64(&redisTokenSeq, 1))
+}
+
+type redisLease struct {
+	owner string
+	token int64
+	stop  chan struct{}
+	lost  chan struct{}
+	done  chan struct{}
+}
+
+// RedisMutex is a lock shared through Redis. It is held for a lease of ttl
+// which is renewed in the background until Unlock, so a crashed holder only
+// blocks the others for ttl.
+//
+// Every acquisition gets a fencing token greater than all the previous ones;
+// pass it along with writes so that the storage can refuse a holder whose
+// lease has silently expired.
+type RedisMutex struct {
+	handler  *RedisHandler
+	key      string
+	fenceKey string
+	ttl      time.Duration
+	mutex    *sync.Mutex
+	lease    *redisLease
+	// lost is the lost channel of the last lease, kept once it is dropped
+	// until the lock is taken again.
+	lost chan struct{}
+}
+
+// NewMutex returns a lock stored under key. The fencing counter is kept under
+// key + ":fence".
+func (h *RedisHandler) NewMutex(key string, ttl time.Duration) *RedisMutex {
+	if ttl < 10*time.Millisecond {
+		ttl = 10 * time.Millisecond
+	}
+	return &RedisMutex{
+		handler:  h,
+		key:      key,
+		fenceKey: key + ":fence",
+		ttl:      ttl,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// TryLock takes the lock if it is free.
+func (m *RedisMutex) TryLock() (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.lease != nil {
+		return false, fmt.Errorf("Lock %s is already held.", m.key)
+	}
+
+	owner := redisToken()
+	token, err := redis.Int64(m.handler.script(redisLockAcquireScript, m.key, m.fenceKey, owner, int64(m.ttl/time.Millisecond)))
+	if err != nil {
+		return false, fmt.Errorf("error locking key %s: %w", m.key, err)
+	}
+	if token == 0 {
+		return false, nil
+	}
+	m.lease = &redisLease{
+		owner: owner,
+		token: token,
+		stop:  make(chan struct{}),
+		lost:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	m.lost = nil
+	go m.keepAlive(m.lease)
+	return true, nil
+}
+
+// Lock waits until the lock is taken or ctx is done.
+func (m *RedisMutex) Lock(ctx context.Context) error {
+	retry := m.ttl / 10
+	for {
+		ok, err := m.TryLock()
+		if err != nil || ok {
+			return err
+		}
+		timer := time.NewTimer(retry)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// Token returns the fencing token of the current lease, 0 if not held.
+func (m *RedisMutex) Token() int64 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.lease == nil {
+		return 0
+	}
+	return m.lease.token
+}
+
+// Lost is closed when the current lease could not be renewed in time, after
+// which the lock may be held by someone else and is no longer held here.
+// Once the lease is lost it returns the closed channel until the lock is
+// taken again, and otherwise nil when not held.
+func (m *RedisMutex) Lost() <-chan struct{} {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.lease == nil {
+		return m.lost
+	}
+	return m.lease.lost
+}
+
+// Renew extends the current lease by ttl right away.
+func (m *RedisMutex) Renew() error {
+	m.mutex.Lock()
+	lease := m.lease
+	m.mutex.Unlock()
+	if lease == nil {
+		return ErrLockNotHeld
+	}
+	return m.renew(lease)
+}
+
+func (m *RedisMutex) renew(lease *redisLease) error {
+	ok, err := redis.Bool(m.handler.script(redisLockRenewScript, m.key, lease.owner, int64(m.ttl/time.Millisecond)))
+	if err != nil {
+		return fmt.Errorf("error renewing lock %s: %w", m.key, err)
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// keepAlive renews the lease every third of ttl. Failed renewals are retried
+// until the lease is known to be gone or would have expired.
+func (m *RedisMutex) keepAlive(lease *redisLease) {
+	defer close(lease.done)
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+		case <-lease.stop:
+			return
+		}
+		err := m.renew(lease)
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		if err == ErrLockNotHeld || time.Since(renewed) >= m.ttl {
+			// Drop the lease so that TryLock can compete for the lock again.
+			m.mutex.Lock()
+			if m.lease == lease {
+				m.lease = nil
+				m.lost = lease.lost
+			}
+			m.mutex.Unlock()
+			close(lease.lost)
+			return
+		}
+	}
+}
+
+// Unlock releases the lock. It returns ErrLockNotHeld if the lease was lost
+// in the meantime, in which case nothing is deleted.
+func (m *RedisMutex) Unlock() error {
+	m.mutex.Lock()
+	lease := m.lease
+	m.lease = nil
+	m.mutex.Unlock()
+	if lease == nil {
+		return ErrLockNotHeld
+	}
+	close(lease.stop)
+	<-lease.done
+
+	ok, err := redis.Bool(m.handler.script(redisLockReleaseScript, m.key, lease.owner))
+	if err != nil {
+		return fmt.Errorf("error unlocking key %s: %w", m.key, err)
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package net
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+)
+
+// BreakerClient calls the HTTP helpers through a circuit breaker. Unless the
+// breaker is configured with IsFailure, answers with a 4xx status are the
+// caller's fault and do not count as failures.
+type BreakerClient struct {
+	*concurrency.CircuitBreaker
+}
+
+func NewBreakerClient(name string, conf concurrency.BreakerConfig) *BreakerClient {
+	return &BreakerClient{
+		CircuitBreaker: concurrency.NewCircuitBreaker(name, conf),
+	}
+}
+
+// IsServerFailure reports whether err means the server could not be reached
+// or failed to handle the request.
+func IsServerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if e, ok := err.(*StatusError); ok {
+		return e.StatusCode >= 500
+	}
+	return true
+}
+
+func (c *BreakerClient) call(f func() ([]byte, error)) ([]byte, error) {
+	done, err := c.Allow()
+	if err != nil {
+		return nil, err
+	}
+	failed := true
+	defer func() {
+		done(failed)
+	}()
+	data, err := f()
+	failed = c.IsFailure(err, IsServerFailure)
+	return data, err
+}
+
+func (c *BreakerClient) HTTPGet(url string, headers map[string]string, cookies []*http.Cookie) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return HTTPGet(url, headers, cookies)
+	})
+}
+
+func (c *BreakerClient) HTTPGetWithTimeout(url string, headers map[string]string, cookies []*http.Cookie, timeout time.Duration) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return HTTPGetWithTimeout(url, headers, cookies, timeout)
+	})
+}
+
+func (c *BreakerClient) CustomRequest(method string, url string, bodyData []byte) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return CustomRequest(method, url, bodyData)
+	})
+}
+
+func (c *BreakerClient) HTTPPost(url string, bodyData []byte) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return HTTPPost(url, bodyData)
+	})
+}
+
+func (c *BreakerClient) HTTPPostV1(url string, bodyData []byte, headers map[string]string, cookies []*http.Cookie, timeout time.Duration) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return HTTPPostV1(url, bodyData, headers, cookies, timeout)
+	})
+}
+
+func (c *BreakerClient) HTTPDelete(url string, bodyData []byte) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return HTTPDelete(url, bodyData)
+	})
+}
+
+func (c *BreakerClient) HTTPPut(url string, bodyData []byte) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return HTTPPut(url, bodyData)
+	})
+}
+
+func (c *BreakerClient) FormPost(url string, bodyData []byte) ([]byte, error) {
+	return c.call(func() ([]byte, error) {
+		return FormPost(url, bodyData)
+	})
+}
@@ -9,6 +9,17 @@ import (
 	"time"
 )
 
+// StatusError is returned by the HTTP helpers when the server answers with an
+// error status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Failed to call [%s], status code: %d", e.URL, e.StatusCode)
+}
+
 func HTTPGet(url string, headers map[string]string, cookies []*http.Cookie) ([]byte, error) {
 	return HTTPGetWithTimeout(url, headers, cookies, time.Duration(0))
 }
@@ -28,7 +39,7 @@ func CustomRequest(method string, url string, bodyData []byte) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("Failed to call [%s], status code: %d", url, resp.StatusCode)
+		return nil, &StatusError{URL: url, StatusCode: resp.StatusCode}
 	}
 
 	return ioutil.ReadAll(resp.Body)
@@ -57,7 +68,7 @@ func HTTPGetWithTimeout(url string, headers map[string]string, cookies []*http.C
 	defer res.Body.Close()
 
 	if res.StatusCode >= 400 {
-		return nil, fmt.Errorf("Failed to call [%s], status code: %d", url, res.StatusCode)
+		return nil, &StatusError{URL: url, StatusCode: res.StatusCode}
 	}
 
 	return ioutil.ReadAll(res.Body)
@@ -72,7 +83,7 @@ func HTTPPost(url string, bodyData []byte) ([]byte, error) {
 	defer res.Body.Close()
 
 	if res.StatusCode >= 400 {
-		return nil, fmt.Errorf("Failed to call [%s], status code: %d", url, res.StatusCode)
+		return nil, &StatusError{URL: url, StatusCode: res.StatusCode}
 	}
 
 	return ioutil.ReadAll(res.Body)
@@ -103,7 +114,7 @@ func HTTPPostV1(url string, bodyData []byte, headers map[string]string, cookies
 	defer res.Body.Close()
 
 	if res.StatusCode >= 400 {
-		return nil, fmt.Errorf("Failed to call [%s], status code: %d", url, res.StatusCode)
+		return nil, &StatusError{URL: url, StatusCode: res.StatusCode}
 	}
 
 	return ioutil.ReadAll(res.Body)
@@ -147,13 +158,13 @@ func FormPost(url string, bodyData []byte) ([]byte, error) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	client := &http.Client{}
 	res, err := client.Do(req)
-	defer res.Body.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode >= 400 {
-		return nil, fmt.Errorf("Failed to call [%s], status code: %d", url, res.StatusCode)
+		return nil, &StatusError{URL: url, StatusCode: res.StatusCode}
 	}
 
 	return ioutil.ReadAll(res.Body)
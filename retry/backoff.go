@@ -0,0 +1,49 @@
+package retry
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff returns the delay before retry number attempt, starting at 1, given
+// the delay used before the previous retry.
+type Backoff func(attempt int, last time.Duration) time.Duration
+
+// Constant waits d before every retry.
+func Constant(d time.Duration) Backoff {
+	return func(int, time.Duration) time.Duration {
+		return d
+	}
+}
+
+// Exponential doubles the delay on every retry, from base up to max.
+func Exponential(base, max time.Duration) Backoff {
+	return func(attempt int, _ time.Duration) time.Duration {
+		d := base
+		for i := 1; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// DecorrelatedJitter picks a random delay between base and three times the
+// last one, up to max, which spreads out clients retrying together.
+func DecorrelatedJitter(base, max time.Duration) Backoff {
+	return func(_ int, last time.Duration) time.Duration {
+		if last < base {
+			last = base
+		}
+		d := base
+		if spread := 3*last - base; spread > 0 {
+			d += time.Duration(rand.Int63n(int64(spread)))
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
@@ -0,0 +1,141 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+	"github.com/heqzha/goutils/net"
+	"gopkg.in/mgo.v2"
+)
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not worth retrying. Do returns err itself.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// IsRetryable is the default classification of errors. Errors marked
+// Permanent, context errors, mgo.ErrNotFound and 4xx answers from the net
+// helpers, except 408 and 429, are not retried; everything else is.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, mgo.ErrNotFound) {
+		return false
+	}
+	var status *net.StatusError
+	if errors.As(err, &status) {
+		switch status.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests:
+			return true
+		}
+		return status.StatusCode >= 500
+	}
+	return true
+}
+
+// Policy tells how often and how long to retry. Backoff defaults to
+// Exponential(100ms, 10s) and Retryable to IsRetryable. MaxAttempts counts the
+// first call too and MaxElapsed is measured from it; when both are zero
+// MaxAttempts is 3. OnRetry, when set, is called before waiting for a retry.
+type Policy struct {
+	Backoff     Backoff
+	MaxAttempts int
+	MaxElapsed  time.Duration
+	Retryable   func(err error) bool
+	OnRetry     func(attempt int, err error, delay time.Duration)
+	Clock       concurrency.Clock
+}
+
+// DefaultPolicy makes 3 attempts with exponential backoff.
+var DefaultPolicy = Policy{}
+
+func (p Policy) normalize() Policy {
+	if p.Backoff == nil {
+		p.Backoff = Exponential(100*time.Millisecond, 10*time.Second)
+	}
+	if p.MaxAttempts <= 0 && p.MaxElapsed <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsRetryable
+	}
+	if p.Clock == nil {
+		p.Clock = concurrency.SystemClock
+	}
+	return p
+}
+
+// Do calls f until it succeeds, fails with an error which is not retryable
+// or the policy gives up, and returns the last error of f. It returns
+// ctx.Err() if ctx is done first.
+func (p Policy) Do(ctx context.Context, f func(ctx context.Context) error) error {
+	_, err := DoValue(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, f(ctx)
+	})
+	return err
+}
+
+// Do calls f with DefaultPolicy.
+func Do(ctx context.Context, f func(ctx context.Context) error) error {
+	return DefaultPolicy.Do(ctx, f)
+}
+
+// DoValue is Policy.Do for functions returning a value, such as the net
+// helpers.
+func DoValue[T any](ctx context.Context, p Policy, f func(ctx context.Context) (T, error)) (T, error) {
+	p = p.normalize()
+	start := p.Clock.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			var zero T
+			return zero, err
+		}
+		v, err := f(ctx)
+		if err == nil || !p.Retryable(err) {
+			if permanent, ok := err.(*permanentError); ok {
+				err = permanent.err
+			}
+			return v, err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return v, err
+		}
+		delay = p.Backoff(attempt, delay)
+		if p.MaxElapsed > 0 && p.Clock.Now().Add(delay).Sub(start) > p.MaxElapsed {
+			return v, err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		select {
+		case <-p.Clock.After(delay):
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
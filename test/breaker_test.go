@@ -0,0 +1,112 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	transitions := []string{}
+	b := concurrency.NewCircuitBreaker("test", concurrency.BreakerConfig{
+		Trip:             concurrency.TripAfterFailures(3),
+		OpenTimeout:      time.Minute,
+		HalfOpenRequests: 2,
+		Clock:            clock,
+		OnStateChange: func(name string, from, to concurrency.BreakerState) {
+			transitions = append(transitions, fmt.Sprintf("%s:%s->%s", name, from, to))
+		},
+	})
+	fail := func() error { return fmt.Errorf("down") }
+	ok := func() error { return nil }
+
+	b.Execute(fail)
+	b.Execute(fail)
+	b.Execute(ok)
+	b.Execute(fail)
+	b.Execute(fail)
+	if b.State() != concurrency.StateClosed {
+		t.Fatal("expected a success to reset the consecutive failures")
+	}
+	b.Execute(fail)
+	if b.State() != concurrency.StateOpen {
+		t.Fatalf("expected the breaker to open, got %s", b.State())
+	}
+	called := false
+	if err := b.Execute(func() error { called = true; return nil }); err != concurrency.ErrCircuitOpen || called {
+		t.Errorf("expected ErrCircuitOpen without calling, got %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if b.State() != concurrency.StateHalfOpen {
+		t.Fatalf("expected the breaker to be half-open, got %s", b.State())
+	}
+	done1, err1 := b.Allow()
+	done2, err2 := b.Allow()
+	if _, err := b.Allow(); err1 != nil || err2 != nil || err != concurrency.ErrCircuitOpen {
+		t.Fatalf("expected exactly 2 probes, got %v %v %v", err1, err2, err)
+	}
+	done1(false)
+	done2(true)
+	if b.State() != concurrency.StateOpen {
+		t.Fatalf("expected a failed probe to reopen the breaker, got %s", b.State())
+	}
+
+	clock.Advance(time.Minute)
+	b.Execute(ok)
+	b.Execute(ok)
+	if b.State() != concurrency.StateClosed {
+		t.Fatalf("expected the probes to close the breaker, got %s", b.State())
+	}
+	expected := []string{
+		"test:closed->open", "test:open->half-open", "test:half-open->open",
+		"test:open->half-open", "test:half-open->closed",
+	}
+	if fmt.Sprint(transitions) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, transitions)
+	}
+}
+
+func TestCircuitBreakerFailureRatio(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := concurrency.NewCircuitBreaker("ratio", concurrency.BreakerConfig{
+		Trip:   concurrency.TripOnFailureRatio(0.5, 4),
+		Window: 10 * time.Second,
+		Clock:  clock,
+		IsFailure: func(err error) bool {
+			return err != nil && err.Error() != "not found"
+		},
+	})
+	outcomes := []error{nil, fmt.Errorf("down"), fmt.Errorf("not found"), fmt.Errorf("down")}
+
+	for _, err := range outcomes[:3] {
+		e := err
+		b.Execute(func() error { return e })
+	}
+	if c := b.Counts(); c.Requests != 3 || c.Failures != 1 {
+		t.Errorf("unexpected counts %+v", c)
+	}
+	clock.Advance(10 * time.Second)
+	if c := b.Counts(); c.Requests != 0 {
+		t.Errorf("expected the window to reset the counts, got %+v", c)
+	}
+
+	// A call started in an old window does not count in the new one.
+	done, _ := b.Allow()
+	clock.Advance(10 * time.Second)
+	done(true)
+	if c := b.Counts(); c.Failures != 0 {
+		t.Errorf("expected a stale outcome to be ignored, got %+v", c)
+	}
+
+	for _, err := range outcomes {
+		e := err
+		b.Execute(func() error { return e })
+	}
+	if b.State() != concurrency.StateOpen {
+		t.Errorf("expected 2 failures out of 4 to open the breaker, got %s", b.State())
+	}
+}
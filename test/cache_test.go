@@ -0,0 +1,190 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/container"
+)
+
+func TestCacheLRU(t *testing.T) {
+	evicted := []string{}
+	c := container.NewCache[string, int](container.CacheOptions[string, int]{
+		Shards:  1,
+		MaxCost: 3,
+		OnEvict: func(key string, value int, reason container.EvictReason) {
+			if reason == container.EvictedCapacity {
+				evicted = append(evicted, key)
+			}
+		},
+	})
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Set("d", 4)
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected b to be evicted")
+	}
+	if fmt.Sprint(evicted) != "[b]" || c.Len() != 3 {
+		t.Errorf("unexpected evictions %v", evicted)
+	}
+	if s := c.Stats(); s.Hits != 1 || s.Misses != 1 || s.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCacheLFUAndCost(t *testing.T) {
+	c := container.NewCache[string, string](container.CacheOptions[string, string]{
+		Shards:  1,
+		MaxCost: 10,
+		Policy:  container.EvictLFU,
+		Cost:    func(v string) int64 { return int64(len(v)) },
+	})
+	c.Set("hot", "xxxx")
+	c.Set("cold", "xxxx")
+	for i := 0; i < 3; i++ {
+		c.Get("hot")
+	}
+	c.Get("cold")
+	c.Set("new", "xxxx")
+	if _, ok := c.Get("cold"); ok {
+		t.Error("expected the least frequently used entry to be evicted")
+	}
+	if _, ok := c.Get("hot"); !ok || c.Cost() != 8 {
+		t.Errorf("expected hot to stay, cost %d", c.Cost())
+	}
+	if c.Set("huge", "xxxxxxxxxxxx") {
+		t.Error("expected an entry over the limit to be rejected")
+	}
+}
+
+func TestCacheMaxCostAcrossShards(t *testing.T) {
+	c := container.NewCache[int, string](container.CacheOptions[int, string]{
+		MaxCost: 10,
+	})
+	for i := 0; i < 100; i++ {
+		c.Set(i, "v")
+		if c.Cost() > 10 {
+			t.Fatalf("expected the cost to stay within 10, got %d", c.Cost())
+		}
+	}
+	if c.Len() != 10 {
+		t.Errorf("expected 10 entries, got %d", c.Len())
+	}
+
+	big := container.NewCache[int, int](container.CacheOptions[int, int]{
+		MaxCost: 100,
+		Cost:    func(v int) int64 { return int64(v) },
+	})
+	for i := 0; i < 20; i++ {
+		if !big.Set(i, 10) {
+			t.Fatal("expected a value within MaxCost to be stored")
+		}
+	}
+	if big.Cost() != 100 || big.Set(-1, 101) {
+		t.Errorf("expected a cost of 100 and the oversized value rejected, got %d", big.Cost())
+	}
+	if _, ok := big.Get(19); !ok {
+		t.Error("expected the last value set to be kept")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := container.NewCache[int, string](container.CacheOptions[int, string]{TTL: 20 * time.Millisecond})
+	c.Set(1, "short")
+	c.SetWithTTL(2, "long", time.Hour)
+	c.SetWithTTL(3, "short", 0)
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get(1); ok {
+		t.Error("expected 1 to expire")
+	}
+	c.DeleteExpired()
+	if c.Len() != 2 {
+		t.Errorf("expected 2 entries left, got %d", c.Len())
+	}
+	if !c.Delete(2) || c.Delete(2) {
+		t.Error("expected delete to succeed once")
+	}
+}
+
+func TestCacheGetOrLoad(t *testing.T) {
+	calls := int32(0)
+	release := make(chan struct{})
+	c := container.NewCache[string, string](container.CacheOptions[string, string]{
+		Loader: func(key string) (string, error) {
+			atomic.AddInt32(&calls, 1)
+			<-release
+			if key == "missing" {
+				return "", fmt.Errorf("not found")
+			}
+			return "v:" + key, nil
+		},
+	})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.GetOrLoad("k"); v != "v:k" || err != nil {
+				t.Errorf("unexpected %s %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("expected one load, got %d", calls)
+	}
+	if v, ok := c.Get("k"); !ok || v != "v:k" {
+		t.Error("expected the loaded value to be cached")
+	}
+	if _, err := c.GetOrLoad("missing"); err == nil || c.Len() != 1 {
+		t.Error("expected a failed load not to be cached")
+	}
+	if s := c.Stats(); s.Loads != 2 || s.LoadErrors != 1 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
+
+func TestCacheSetDuringLoad(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	c := container.NewCache[string, string](container.CacheOptions[string, string]{
+		Loader: func(key string) (string, error) {
+			close(started)
+			<-release
+			return "loaded", nil
+		},
+	})
+	loaded := make(chan string)
+	go func() {
+		v, _ := c.GetOrLoad("k")
+		loaded <- v
+	}()
+	<-started
+	c.Set("k", "newer")
+	close(release)
+	if v := <-loaded; v != "loaded" {
+		t.Errorf("expected the load result, got %s", v)
+	}
+	if v, _ := c.Get("k"); v != "newer" {
+		t.Errorf("expected the value set during the load to be kept, got %s", v)
+	}
+
+	started, release = make(chan struct{}), make(chan struct{})
+	go func() {
+		v, _ := c.GetOrLoad("d")
+		loaded <- v
+	}()
+	<-started
+	c.Delete("d")
+	close(release)
+	<-loaded
+	if _, ok := c.Get("d"); ok {
+		t.Error("expected a load overtaken by a delete not to be cached")
+	}
+}
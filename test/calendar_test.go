@@ -0,0 +1,120 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/date"
+)
+
+const holidaysICal = "BEGIN:VCALENDAR\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20241001\r\n" +
+	"DTEND;VALUE=DATE:20241004\r\n" +
+	"SUMMARY:National\r\n" +
+	"  Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20241225T000000Z\r\n" +
+	"SUMMARY:Christmas\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func ymd(t *testing.T, loc *time.Location, s string) time.Time {
+	d, err := time.ParseInLocation("2006-01-02", s, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestCalendar(t *testing.T) {
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip(err)
+	}
+	c := date.NewCalendar(loc)
+	if err := c.LoadICal(strings.NewReader(holidaysICal)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadJSON(strings.NewReader(`[{"date": "2024-01-01", "name": "New Year"}]`)); err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := c.Holiday(ymd(t, loc, "2024-10-03")); !ok || name != "National Day" {
+		t.Errorf("expected National Day, got %q", name)
+	}
+	if _, ok := c.Holiday(ymd(t, loc, "2024-10-04")); ok {
+		t.Error("expected DTEND to be excluded")
+	}
+	if !c.IsBusinessDay(ymd(t, loc, "2024-12-24")) || c.IsBusinessDay(ymd(t, loc, "2024-12-25")) {
+		t.Error("unexpected business days around Christmas")
+	}
+
+	// Monday 30 September: the next business day is Friday 4 October.
+	next, _ := c.NextBusinessDay(ymd(t, loc, "2024-09-30"))
+	if !next.Equal(ymd(t, loc, "2024-10-04")) {
+		t.Errorf("expected 2024-10-04, got %s", next)
+	}
+	prev, _ := c.PrevBusinessDay(ymd(t, loc, "2024-10-07"))
+	if !prev.Equal(ymd(t, loc, "2024-10-04")) {
+		t.Errorf("expected 2024-10-04, got %s", prev)
+	}
+	added, _ := c.AddBusinessDays(ymd(t, loc, "2024-09-27"), 3)
+	if !added.Equal(ymd(t, loc, "2024-10-07")) {
+		t.Errorf("expected 2024-10-07, got %s", added)
+	}
+	back, _ := c.AddBusinessDays(added, -3)
+	if !back.Equal(ymd(t, loc, "2024-09-27")) {
+		t.Errorf("expected 2024-09-27, got %s", back)
+	}
+
+	// The date is taken in the calendar location: 20:00 UTC on Friday is
+	// already Saturday in Shanghai.
+	if c.IsBusinessDay(time.Date(2024, 9, 27, 20, 0, 0, 0, time.UTC)) {
+		t.Error("expected Saturday in Shanghai")
+	}
+
+	from, to := ymd(t, loc, "2024-09-30"), ymd(t, loc, "2024-10-14")
+	if n := c.BusinessDaysBetween(from, to); n != 7 {
+		t.Errorf("expected 7 business days, got %d", n)
+	}
+	if n := c.BusinessDaysBetween(to, from); n != -7 {
+		t.Errorf("expected -7 business days, got %d", n)
+	}
+
+	c.SetWeekend()
+	if !c.IsBusinessDay(ymd(t, loc, "2024-09-28")) {
+		t.Error("expected Saturday to be a business day without weekend")
+	}
+}
+
+func TestCalendarByLocation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "holidays.json")
+	os.WriteFile(path, []byte(`[{"date": "2024-07-04", "name": "Independence Day"}]`), 0644)
+	c := date.NewCalendar(nil)
+	if err := c.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	date.RegisterCalendar("Test/Location", c)
+	if date.CalendarByLocation("Test/Location") != c {
+		t.Error("expected the registered calendar")
+	}
+	if loc := date.CalendarByLocation("Not/AZone").Location(); loc != time.UTC {
+		t.Errorf("expected UTC for an unknown location, got %s", loc)
+	}
+	if err := c.LoadFile(filepath.Join(t.TempDir(), "holidays.txt")); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+	if err := c.LoadJSON(strings.NewReader(`[{"date": "July 4"}]`)); err == nil {
+		t.Error("expected an invalid date to fail")
+	}
+
+	never := date.NewCalendar(nil)
+	never.SetWeekend(time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday)
+	if _, err := never.NextBusinessDay(time.Now()); err == nil {
+		t.Error("expected a calendar without business days to fail")
+	}
+}
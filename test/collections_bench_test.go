@@ -0,0 +1,137 @@
+package test
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/heqzha/goutils/container"
+)
+
+const benchKeys = 1 << 12
+
+// rwMap is a plain map guarded by one RWMutex, the way MtxGroupQueue guards
+// its groups.
+type rwMap struct {
+	m     map[string]int
+	mutex *sync.RWMutex
+}
+
+func (r *rwMap) get(k string) (int, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	v, ok := r.m[k]
+	return v, ok
+}
+
+func (r *rwMap) set(k string, v int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.m[k] = v
+}
+
+func benchKeyNames() []string {
+	keys := make([]string, benchKeys)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	return keys
+}
+
+// One write every writeEvery operations.
+const writeEvery = 10
+
+func BenchmarkConcurrentMap(b *testing.B) {
+	keys := benchKeyNames()
+	m := container.NewConcurrentMap[string, int](0)
+	for i, k := range keys {
+		m.Set(k, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			k := keys[i%benchKeys]
+			if i%writeEvery == 0 {
+				m.Set(k, i)
+			} else {
+				m.Get(k)
+			}
+		}
+	})
+}
+
+func BenchmarkRWMutexMap(b *testing.B) {
+	keys := benchKeyNames()
+	m := &rwMap{m: make(map[string]int), mutex: &sync.RWMutex{}}
+	for i, k := range keys {
+		m.set(k, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			k := keys[i%benchKeys]
+			if i%writeEvery == 0 {
+				m.set(k, i)
+			} else {
+				m.get(k)
+			}
+		}
+	})
+}
+
+func BenchmarkSetIntersect(b *testing.B) {
+	s, o := container.NewSet[int](), container.NewSet[int]()
+	for i := 0; i < benchKeys; i++ {
+		s.Add(i)
+		o.Add(2 * i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.Intersect(o)
+	}
+}
+
+func BenchmarkRWMutexMapIntersect(b *testing.B) {
+	s, o := map[int]struct{}{}, map[int]struct{}{}
+	for i := 0; i < benchKeys; i++ {
+		s[i] = struct{}{}
+		o[2*i] = struct{}{}
+	}
+	mutex := &sync.RWMutex{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mutex.RLock()
+		r := map[int]struct{}{}
+		for k := range s {
+			if _, ok := o[k]; ok {
+				r[k] = struct{}{}
+			}
+		}
+		mutex.RUnlock()
+	}
+}
+
+func BenchmarkBitSetTest(b *testing.B) {
+	bs := container.NewBitSet(benchKeys)
+	for i := 0; i < benchKeys; i += 3 {
+		bs.Set(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bs.Test(i % benchKeys)
+	}
+}
+
+func BenchmarkRWMutexMapTest(b *testing.B) {
+	m := map[int]bool{}
+	for i := 0; i < benchKeys; i += 3 {
+		m[i] = true
+	}
+	mutex := &sync.RWMutex{}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mutex.RLock()
+		_ = m[i%benchKeys]
+		mutex.RUnlock()
+	}
+}
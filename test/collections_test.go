@@ -0,0 +1,162 @@
+package test
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/heqzha/goutils/container"
+)
+
+func TestSet(t *testing.T) {
+	a := container.NewSet(1, 2, 3, 4)
+	b := container.NewSet(3, 4, 5)
+	sorted := func(s *container.Set[int]) string {
+		items := s.Items()
+		sort.Ints(items)
+		return fmt.Sprint(items)
+	}
+	if got := sorted(a.Union(b)); got != "[1 2 3 4 5]" {
+		t.Errorf("unexpected union %s", got)
+	}
+	if got := sorted(a.Intersect(b)); got != "[3 4]" {
+		t.Errorf("unexpected intersection %s", got)
+	}
+	if got := sorted(a.Diff(b)); got != "[1 2]" {
+		t.Errorf("unexpected difference %s", got)
+	}
+	if !container.NewSet(3, 4).SubsetOf(a) || a.Equal(b) || !a.Equal(a.Clone()) {
+		t.Error("unexpected subset or equality")
+	}
+	if !a.Remove(1) || a.Remove(1) || a.Contains(1) || a.Len() != 3 {
+		t.Error("expected remove to succeed once")
+	}
+}
+
+func TestConcurrentMap(t *testing.T) {
+	m := container.NewConcurrentMap[string, int](4)
+	creates := 0
+	wg := &sync.WaitGroup{}
+	mutex := &sync.Mutex{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.ComputeIfAbsent("shared", func(string) int {
+				mutex.Lock()
+				creates++
+				mutex.Unlock()
+				return 42
+			})
+			m.Set(fmt.Sprintf("k%d", i), i)
+			m.Compute("counter", func(old int, ok bool) (int, bool) {
+				return old + 1, true
+			})
+		}(i)
+	}
+	wg.Wait()
+	if creates != 1 {
+		t.Errorf("expected one create, got %d", creates)
+	}
+	if v, _ := m.Get("counter"); v != 50 {
+		t.Errorf("expected 50, got %d", v)
+	}
+	if m.Len() != 52 {
+		t.Errorf("expected 52 entries, got %d", m.Len())
+	}
+	if v, loaded := m.ComputeIfAbsent("shared", nil); v != 42 || !loaded {
+		t.Error("expected the shared value to be loaded")
+	}
+	m.Compute("counter", func(int, bool) (int, bool) { return 0, false })
+	if _, ok := m.Delete("k7"); !ok || m.Len() != 50 {
+		t.Errorf("expected 50 entries, got %d", m.Len())
+	}
+	n := 0
+	m.Range(func(string, int) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("expected range to stop at 10, got %d", n)
+	}
+}
+
+func TestMultiMap(t *testing.T) {
+	m := container.NewMultiMap[string, int]()
+	m.Put("a", 1, 2, 1)
+	m.Put("b", 3)
+	if fmt.Sprint(m.Get("a")) != "[1 2 1]" || m.Len() != 4 {
+		t.Errorf("unexpected values %v", m.Get("a"))
+	}
+	if !m.Remove("a", 1) || fmt.Sprint(m.Get("a")) != "[2 1]" || !m.Contains("a", 1) {
+		t.Errorf("expected the first 1 removed, got %v", m.Get("a"))
+	}
+	if values := m.RemoveAll("a"); len(values) != 2 || m.Len() != 1 || len(m.Keys()) != 1 {
+		t.Error("expected a to be removed")
+	}
+	if !m.Remove("b", 3) || len(m.Keys()) != 0 {
+		t.Error("expected an emptied key to be removed")
+	}
+}
+
+func TestBitSet(t *testing.T) {
+	b := container.NewBitSet(10)
+	set := []int{0, 3, 64, 65, 500, 513, 1000, 4099}
+	for _, i := range set {
+		b.Set(i)
+	}
+	if !b.Test(513) || b.Test(512) || b.Test(-1) || b.Test(1<<20) {
+		t.Error("unexpected membership")
+	}
+	if b.Count() != len(set) {
+		t.Errorf("expected %d bits, got %d", len(set), b.Count())
+	}
+	for k, i := range set {
+		if r := b.Rank(i); r != k {
+			t.Errorf("expected rank %d for %d, got %d", k, i, r)
+		}
+		if s, ok := b.Select(k); !ok || s != i {
+			t.Errorf("expected select %d to be %d, got %d", k, i, s)
+		}
+	}
+	if _, ok := b.Select(len(set)); ok {
+		t.Error("expected select past the count to fail")
+	}
+	b.Clear(-1)
+	if b.Count() != len(set) || !b.Test(0) {
+		t.Error("expected clearing a negative index to do nothing")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected setting a negative index to panic")
+			}
+		}()
+		b.Set(-1)
+	}()
+	if b.Test(63) {
+		t.Error("expected a negative index not to set bit 63")
+	}
+	b.Clear(500)
+	if r := b.Rank(1001); r != 6 {
+		t.Errorf("expected rank 6 after clearing, got %d", r)
+	}
+	if i, _ := b.NextSet(66); i != 513 {
+		t.Errorf("expected 513, got %d", i)
+	}
+
+	o := container.NewBitSet(0)
+	o.Set(3)
+	o.Set(7)
+	u := container.NewBitSet(0)
+	u.Union(b)
+	u.Intersect(o)
+	if u.Count() != 1 || !u.Test(3) {
+		t.Error("unexpected intersection")
+	}
+	b.Diff(o)
+	if b.Test(3) || b.Count() != 6 {
+		t.Error("unexpected difference")
+	}
+}
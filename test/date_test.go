@@ -0,0 +1,203 @@
+package test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/heqzha/goutils/date"
+)
+
+func zone(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestAddDaysAcrossDST(t *testing.T) {
+	cases := []struct {
+		zone  string
+		from  string
+		days  int
+		to    string
+		hours float64
+	}{
+		// Spring forward, the day is 23h long.
+		{"America/New_York", "2024-03-09 09:30", 1, "2024-03-10 09:30", 23},
+		{"Europe/London", "2024-03-31 00:00", 1, "2024-04-01 00:00", 23},
+		// A time skipped by the change moves forward by the gap.
+		{"America/New_York", "2024-03-09 02:30", 1, "2024-03-10 03:30", 24},
+		// Fall back, the day is 25h long.
+		{"America/New_York", "2024-11-03 09:30", -1, "2024-11-02 09:30", -25},
+		{"Australia/Sydney", "2024-04-06 12:00", 1, "2024-04-07 12:00", 25},
+		// Southern spring forward, several days at once.
+		{"Australia/Sydney", "2024-10-04 08:00", 3, "2024-10-07 08:00", 71},
+		// Beirut skips midnight and time.Date lands after the gap.
+		{"Asia/Beirut", "2024-03-30 00:00", 1, "2024-03-31 01:00", 24},
+		{"Asia/Beirut", "2024-03-30 12:00", 1, "2024-03-31 12:00", 23},
+		// Kathmandu has no DST.
+		{"Asia/Kathmandu", "2024-03-09 09:30", 1, "2024-03-10 09:30", 24},
+	}
+	for _, c := range cases {
+		loc := zone(t, c.zone)
+		from, _ := time.ParseInLocation("2006-01-02 15:04", c.from, loc)
+		to := date.AddDays(from, c.days)
+		if got := to.Format("2006-01-02 15:04"); got != c.to {
+			t.Errorf("%s: expected %s, got %s", c.zone, c.to, got)
+		}
+		if hours := to.Sub(from).Hours(); hours != c.hours {
+			t.Errorf("%s: expected %vh, got %vh", c.zone, c.hours, hours)
+		}
+		if n := date.DaysBetween(from, to); n != c.days {
+			t.Errorf("%s: expected %d days between, got %d", c.zone, c.days, n)
+		}
+	}
+}
+
+func TestDayBoundsAcrossDST(t *testing.T) {
+	ny := zone(t, "America/New_York")
+	spring := time.Date(2024, 3, 10, 15, 0, 0, 0, ny)
+	begin, end := date.BeginOfDay(spring), date.EndOfDay(spring)
+	if d := end.Sub(begin) + time.Nanosecond; d != 23*time.Hour {
+		t.Errorf("expected a 23h day, got %s", d)
+	}
+
+	// Santiago skips midnight: 8 September 2024 starts at 01:00.
+	santiago := zone(t, "America/Santiago")
+	begin = date.BeginOfDay(time.Date(2024, 9, 8, 12, 0, 0, 0, santiago))
+	if got := begin.Format("15:04 -07"); got != "01:00 -03" {
+		t.Errorf("expected the day to start at 01:00 -03, got %s", got)
+	}
+	if end := date.EndOfDay(begin.Add(-time.Nanosecond)); !end.Equal(begin.Add(-time.Nanosecond)) {
+		t.Errorf("expected the previous day to end right before, got %s", end)
+	}
+
+	beirut := zone(t, "Asia/Beirut")
+	begin = date.BeginOfDay(time.Date(2024, 3, 31, 12, 0, 0, 0, beirut))
+	if got := begin.Format("2006-01-02 15:04 -07"); got != "2024-03-31 01:00 +03" {
+		t.Errorf("expected the day to start at 01:00 +03, got %s", got)
+	}
+	if d := date.DateUnixIn("2024-03-31", beirut); d != begin.Unix() {
+		t.Errorf("expected %s, got %s", begin, time.Unix(d, 0).In(beirut))
+	}
+	c := date.NewCalendar(beirut)
+	if next, _ := c.NextBusinessDay(time.Date(2024, 3, 29, 12, 0, 0, 0, beirut)); !next.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, beirut)) {
+		t.Errorf("expected 1 April, got %s", next)
+	}
+	if prev, _ := c.AddBusinessDays(time.Date(2024, 4, 1, 12, 0, 0, 0, beirut), 0); !prev.Equal(time.Date(2024, 4, 1, 0, 0, 0, 0, beirut)) {
+		t.Errorf("expected 1 April, got %s", prev)
+	}
+
+	// The day of the same instant depends on the location.
+	instant := time.Date(2024, 3, 10, 3, 0, 0, 0, time.UTC)
+	if d := date.BeginOfDay(instant.In(ny)); d.Day() != 9 {
+		t.Errorf("expected 9 March in New York, got %s", d)
+	}
+	if d := date.BeginOfDay(instant); d.Day() != 10 {
+		t.Errorf("expected 10 March in UTC, got %s", d)
+	}
+}
+
+func TestPeriodBounds(t *testing.T) {
+	paris := zone(t, "Europe/Paris")
+	// Sunday 27 October 2024, the day clocks fall back in Paris.
+	ts := time.Date(2024, 10, 27, 18, 45, 0, 0, paris)
+	layout := "2006-01-02 15:04:05.999999999 -07"
+	for name, c := range map[string]struct {
+		got      time.Time
+		expected string
+	}{
+		"begin week":    {date.BeginOfWeek(ts, time.Monday), "2024-10-21 00:00:00 +02"},
+		"end week":      {date.EndOfWeek(ts, time.Monday), "2024-10-27 23:59:59.999999999 +01"},
+		"sunday week":   {date.BeginOfWeek(ts, time.Sunday), "2024-10-27 00:00:00 +02"},
+		"begin month":   {date.BeginOfMonth(ts), "2024-10-01 00:00:00 +02"},
+		"end month":     {date.EndOfMonth(ts), "2024-10-31 23:59:59.999999999 +01"},
+		"begin quarter": {date.BeginOfQuarter(ts), "2024-10-01 00:00:00 +02"},
+		"end quarter":   {date.EndOfQuarter(ts), "2024-12-31 23:59:59.999999999 +01"},
+		"begin year":    {date.BeginOfYear(ts), "2024-01-01 00:00:00 +01"},
+		"end year":      {date.EndOfYear(ts), "2024-12-31 23:59:59.999999999 +01"},
+	} {
+		if got := c.got.Format(layout); got != c.expected {
+			t.Errorf("%s: expected %s, got %s", name, c.expected, got)
+		}
+	}
+	if q := date.BeginOfQuarter(time.Date(2024, 6, 30, 0, 0, 0, 0, paris)); q.Month() != time.April {
+		t.Errorf("expected April, got %s", q.Month())
+	}
+}
+
+func TestAddMonths(t *testing.T) {
+	ny := zone(t, "America/New_York")
+	for _, c := range []struct {
+		from     string
+		months   int
+		expected string
+	}{
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2023-01-31", 1, "2023-02-28"},
+		{"2024-03-31", -1, "2024-02-29"},
+		{"2024-05-31", 1, "2024-06-30"},
+		{"2024-11-30", 3, "2025-02-28"},
+		{"2024-02-29", 12, "2025-02-28"},
+	} {
+		from, _ := time.ParseInLocation("2006-01-02", c.from, ny)
+		if got := date.AddMonths(from, c.months).Format("2006-01-02"); got != c.expected {
+			t.Errorf("%s %+d months: expected %s, got %s", c.from, c.months, c.expected, got)
+		}
+	}
+	// Crossing DST keeps the wall clock time.
+	from := time.Date(2024, 2, 10, 8, 0, 0, 0, ny)
+	if got := date.AddMonths(from, 1); got.Hour() != 8 || got.Sub(from) != (29*24-1)*time.Hour {
+		t.Errorf("unexpected %s", got)
+	}
+	if got := date.AddYears(time.Date(2024, 2, 29, 0, 0, 0, 0, ny), 1); got.Day() != 28 {
+		t.Errorf("expected 28 February, got %s", got)
+	}
+	if date.DaysIn(2024, time.February) != 29 || date.DaysIn(2100, time.February) != 28 {
+		t.Error("unexpected February lengths")
+	}
+}
+
+func TestDateUnixIn(t *testing.T) {
+	tokyo := zone(t, "Asia/Tokyo")
+	if d := date.DateUnix("2024-01-01") - date.DateUnixIn("2024-01-01", tokyo); d != 9*3600 {
+		t.Errorf("expected Tokyo 9h ahead of UTC, got %ds", d)
+	}
+	if d := date.DateMillisecondIn("2024-01-01", tokyo); d != date.DateUnixIn("2024-01-01", tokyo)*1000 {
+		t.Errorf("unexpected milliseconds %d", d)
+	}
+	santiago := zone(t, "America/Santiago")
+	if d := date.DateUnixByLocation("2024-09-08", "America/Santiago"); d != time.Date(2024, 9, 8, 1, 0, 0, 0, santiago).Unix() {
+		t.Errorf("expected the day to start at 01:00, got %s", time.Unix(d, 0).In(santiago))
+	}
+	if date.DateUnixIn("2024-13-01", tokyo) != 0 {
+		t.Error("expected 0 for an invalid date")
+	}
+
+	for _, name := range []string{"America/New_York", "Europe/London", "Australia/Sydney"} {
+		loc := zone(t, name)
+		today := date.TodayIn(loc)
+		for days := int64(0); days < 400; days += 7 {
+			d := date.DaysBeforeNowIn(days, loc)
+			if d.Hour() != 0 || date.DaysBetween(d, today) != int(days) {
+				t.Fatalf("%s: %d days before today is %s", name, days, d)
+			}
+		}
+	}
+}
+
+// Every day from 2010 to 2024 starts on that day, at its first instant, in
+// zones whose DST changes skip or repeat midnight on either side of UTC.
+func TestBeginOfDayEveryDay(t *testing.T) {
+	for _, name := range []string{"Asia/Beirut", "Asia/Amman", "Asia/Damascus", "Asia/Gaza", "America/Santiago", "America/Havana", "America/New_York"} {
+		loc := zone(t, name)
+		for d := time.Date(2010, 1, 1, 12, 0, 0, 0, loc); d.Year() < 2025; d = date.AddDays(d, 1) {
+			begin := date.BeginOfDay(d)
+			if begin.Day() != d.Day() || begin.Add(-time.Nanosecond).Day() == d.Day() {
+				t.Fatalf("%s: %s starts at %s", name, d.Format("2006-01-02"), begin)
+			}
+		}
+	}
+}
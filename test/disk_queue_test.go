@@ -0,0 +1,125 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heqzha/goutils/container"
+	"github.com/heqzha/goutils/file"
+)
+
+func segments(t *testing.T, dir string) int {
+	names, err := file.GetFilesList(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, name := range names {
+		if filepath.Ext(name) == ".seg" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "queue")
+	q, err := container.OpenDiskQueue(dir, container.DiskQueueOptions{SegmentSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := q.Push([]byte(fmt.Sprintf("msg-%d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := segments(t, dir); n < 3 {
+		t.Fatalf("expected the queue to roll over segments, got %d", n)
+	}
+
+	m0, _, _ := q.Pop()
+	m1, _, _ := q.Pop()
+	m2, _, _ := q.Pop()
+	if string(m0.Data) != "msg-0" || string(m2.Data) != "msg-2" {
+		t.Fatalf("unexpected messages %q %q", m0.Data, m2.Data)
+	}
+	q.Ack(m0.ID)
+	q.Ack(m2.ID)
+	q.Nack(m1.ID)
+	if err := q.Ack(m1.ID); err == nil {
+		t.Error("expected acking a nacked message to fail")
+	}
+	if m, _, _ := q.Pop(); m.ID != m1.ID {
+		t.Errorf("expected the nacked message to be redelivered, got %q", m.Data)
+	}
+	// msg-1 is left in flight when the process "crashes".
+	m3, _, _ := q.Pop()
+	q.Ack(m3.ID)
+
+	q, err = container.OpenDiskQueue(dir, container.DiskQueueOptions{SegmentSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for {
+		m, ok, err := q.Pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, string(m.Data))
+		q.Ack(m.ID)
+	}
+	if fmt.Sprint(got) != "[msg-1 msg-4 msg-5 msg-6 msg-7 msg-8 msg-9]" {
+		t.Errorf("unexpected recovered messages %v", got)
+	}
+	if n := segments(t, dir); n != 1 {
+		t.Errorf("expected acked segments to be compacted, got %d", n)
+	}
+
+	id, _ := q.Push([]byte("after"))
+	if id != 11 {
+		t.Errorf("expected ids to keep growing, got %d", id)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Push(nil); err != container.ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestDiskQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	q, err := container.OpenDiskQueue(dir, container.DiskQueueOptions{Sync: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push([]byte("kept"))
+	q.Close()
+
+	names, _ := file.GetFilesList(dir)
+	for _, name := range names {
+		if filepath.Ext(name) == ".seg" {
+			f, _ := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_APPEND, 0644)
+			f.Write([]byte{0, 1, 2, 3, 0, 0, 0, 9, 1})
+			f.Close()
+		}
+	}
+
+	q, err = container.OpenDiskQueue(dir, container.DiskQueueOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.Push([]byte("next"))
+	for _, expected := range []string{"kept", "next"} {
+		if m, ok, _ := q.Pop(); !ok || string(m.Data) != expected {
+			t.Errorf("expected %s, got %q", expected, m.Data)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+)
+
+func TestTokenBucket(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Unix(0, 0))
+	b := concurrency.NewTokenBucket(10, 2, clock)
+	if !b.Allow() || !b.Allow() || b.Allow() {
+		t.Error("expected a burst of 2")
+	}
+	r := b.Reserve()
+	if !r.OK() || r.Delay() != 100*time.Millisecond {
+		t.Errorf("expected a 100ms reservation, got %s", r.Delay())
+	}
+	r.Cancel()
+	clock.Advance(100 * time.Millisecond)
+	if !b.Allow() || b.Allow() {
+		t.Error("expected one token after 100ms")
+	}
+}
+
+func TestLeakyBucket(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Unix(0, 0))
+	b := concurrency.NewLeakyBucket(10, 2, clock)
+	if !b.Allow() || b.Allow() {
+		t.Error("expected a single immediate event")
+	}
+	for i, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond} {
+		if r := b.Reserve(); !r.OK() || r.Delay() != expected {
+			t.Errorf("reservation %d: expected %s, got %s", i, expected, r.Delay())
+		}
+	}
+	if r := b.Reserve(); r.OK() {
+		t.Error("expected overflow to be refused")
+	}
+	if err := b.Wait(context.Background()); err == nil {
+		t.Error("expected Wait to fail on overflow")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a zero rate to panic")
+		}
+	}()
+	concurrency.NewLeakyBucket(0, 2, clock)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Unix(0, 0))
+	w := concurrency.NewSlidingWindow(3, time.Second, clock)
+	for i := 0; i < 3; i++ {
+		if !w.Allow() {
+			t.Fatalf("event %d refused", i)
+		}
+		clock.Advance(100 * time.Millisecond)
+	}
+	if w.Allow() {
+		t.Error("expected window to be full")
+	}
+	if r := w.Reserve(); r.Delay() != 700*time.Millisecond {
+		t.Errorf("expected 700ms delay, got %s", r.Delay())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.Wait(ctx); err != context.Canceled {
+		t.Errorf("expected Wait to honour ctx, got %v", err)
+	}
+	clock.Advance(time.Second)
+	if !w.Allow() {
+		t.Error("expected the window to slide")
+	}
+}
+
+func TestSlidingWindowReserveAndAllow(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Unix(0, 0))
+	w := concurrency.NewSlidingWindow(2, 10*time.Second, clock)
+	w.Allow()
+	w.Allow()
+	r1, r2 := w.Reserve(), w.Reserve()
+	if r3 := w.Reserve(); r3.Delay() != 20*time.Second {
+		t.Fatalf("expected a slot at 20s, got %s", r3.Delay())
+	}
+	r1.Cancel()
+	r2.Cancel()
+
+	// The events at 0 have expired, leaving the slot reserved at 20s.
+	clock.Advance(10500 * time.Millisecond)
+	if !w.Allow() {
+		t.Fatal("expected room next to the reserved slot")
+	}
+	if w.Allow() {
+		t.Error("expected the window to be full")
+	}
+	// The event at 10.5s has expired, the reserved one has not.
+	clock.Advance(10 * time.Second)
+	if !w.Allow() {
+		t.Error("expected the event allowed before the reserved slot to expire")
+	}
+}
+
+func TestWorkersPoolLimiter(t *testing.T) {
+	wp := concurrency.WorkersPool{
+		Limiter: concurrency.NewTokenBucket(50, 1, nil),
+	}
+	wp.Start(4, 100)
+	defer wp.Stop()
+
+	wg := &sync.WaitGroup{}
+	wg.Add(10)
+	begin := time.Now()
+	for i := 0; i < 10; i++ {
+		wp.Collect(func(interface{}) interface{} {
+			wg.Done()
+			return nil
+		}, nil, 0)
+	}
+	wg.Wait()
+	if elapsed := time.Since(begin); elapsed < 170*time.Millisecond {
+		t.Errorf("expected 10 jobs at 50/s to take about 180ms, took %s", elapsed)
+	}
+}
@@ -2,9 +2,13 @@ package test
 
 import (
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/heqzha/goutils/concurrency"
 	"github.com/heqzha/goutils/net"
 )
 
@@ -19,3 +23,53 @@ func TestHTTPGetEncodeQuery(t *testing.T) {
 	r, err := net.HTTPGet(o.String(), nil, nil)
 	fmt.Println(err, string(r))
 }
+
+func TestBreakerClient(t *testing.T) {
+	status := http.StatusNotFound
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	c := net.NewBreakerClient("http", concurrency.BreakerConfig{
+		Trip:        concurrency.TripAfterFailures(2),
+		OpenTimeout: time.Minute,
+	})
+	for i := 0; i < 3; i++ {
+		_, err := c.HTTPGet(server.URL, nil, nil)
+		if e, ok := err.(*net.StatusError); !ok || e.StatusCode != http.StatusNotFound {
+			t.Fatalf("expected a 404 StatusError, got %v", err)
+		}
+	}
+	if c.State() != concurrency.StateClosed {
+		t.Fatal("expected 4xx answers not to trip the breaker")
+	}
+
+	status = http.StatusBadGateway
+	c.HTTPPost(server.URL, nil)
+	c.HTTPPut(server.URL, nil)
+	if _, err := c.HTTPGet(server.URL, nil, nil); err != concurrency.ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestBreakerClientIsFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := net.NewBreakerClient("http", concurrency.BreakerConfig{
+		Trip:        concurrency.TripAfterFailures(2),
+		OpenTimeout: time.Minute,
+		IsFailure: func(err error) bool {
+			e, ok := err.(*net.StatusError)
+			return err != nil && (!ok || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500)
+		},
+	})
+	c.HTTPGet(server.URL, nil, nil)
+	c.HTTPGet(server.URL, nil, nil)
+	if _, err := c.HTTPGet(server.URL, nil, nil); err != concurrency.ErrCircuitOpen {
+		t.Errorf("expected the configured IsFailure to trip the breaker, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/container"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	q := container.NewPriorityQueue[string](container.MinFirst)
+	q.Push("c", 3)
+	b := q.Push("b", 2)
+	q.Push("a1", 1)
+	q.Push("a2", 1)
+	e := q.Push("e", 5)
+
+	if !q.Update(b, 10) || !q.Remove(e) || q.Remove(e) {
+		t.Fatal("expected update and remove to succeed once")
+	}
+	order := ""
+	for {
+		v, _, ok := q.Pop()
+		if !ok {
+			break
+		}
+		order += v + " "
+	}
+	if order != "a1 a2 c b " {
+		t.Errorf("expected a1 a2 c b, got %s", order)
+	}
+	if q.Update(b, 0) {
+		t.Error("expected a popped item not to be updated")
+	}
+
+	max := container.NewPriorityQueue[int](container.MaxFirst)
+	for _, p := range []int64{4, 9, 1, 7} {
+		max.Push(int(p), p)
+	}
+	if v, p, _ := max.Peek(); v != 9 || p != 9 || max.Len() != 4 {
+		t.Errorf("expected 9 first, got %d", v)
+	}
+}
+
+func TestBlockingPriorityQueue(t *testing.T) {
+	q := container.NewBlockingPriorityQueue[string](container.MaxFirst)
+	popped := make(chan string)
+	go func() {
+		v, _, _ := q.Pop(context.Background())
+		popped <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Push("urgent", 10)
+	if v := <-popped; v != "urgent" {
+		t.Errorf("expected urgent, got %s", v)
+	}
+
+	q.Push("low", 1)
+	q.Push("high", 5)
+	q.Close()
+	if _, err := q.Push("late", 1); err != container.ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	for _, expected := range []string{"high", "low"} {
+		if v, _, err := q.Pop(context.Background()); v != expected || err != nil {
+			t.Errorf("expected %s, got %s %v", expected, v, err)
+		}
+	}
+	if _, _, err := q.Pop(context.Background()); err != container.ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
+
+func TestDelayQueue(t *testing.T) {
+	now := time.Now()
+	d := container.NewDelayQueue[string]()
+	d.Push("later", now.Add(time.Hour))
+	d.Push("past", now.Add(-time.Second))
+	if v, ok := d.Pop(); v != "past" || !ok {
+		t.Errorf("expected past, got %s", v)
+	}
+	if _, ok := d.Pop(); ok {
+		t.Error("expected nothing to be due")
+	}
+	if _, at, _ := d.Peek(); !at.Equal(now.Add(time.Hour)) {
+		t.Errorf("unexpected deadline %s", at)
+	}
+
+	// Deadlines out of the Unix nanosecond range keep their order.
+	d.Push("far", time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC))
+	d.Push("zero", time.Time{})
+	if v, ok := d.Pop(); v != "zero" || !ok {
+		t.Errorf("expected the zero deadline to be due first, got %s", v)
+	}
+	if v, _, _ := d.Peek(); v != "later" {
+		t.Errorf("expected later before the far deadline, got %s", v)
+	}
+
+	b := container.NewBlockingDelayQueue[string]()
+	start := time.Now()
+	b.Push("second", start.Add(40*time.Millisecond))
+	late, _ := b.Push("never", start.Add(time.Hour))
+	b.Push("first", start.Add(20*time.Millisecond))
+	for _, expected := range []string{"first", "second"} {
+		if v, err := b.Pop(context.Background()); v != expected || err != nil {
+			t.Errorf("expected %s, got %s %v", expected, v, err)
+		}
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Errorf("expected to wait for the deadlines, waited %s", waited)
+	}
+
+	// Moving a deadline earlier wakes the consumer.
+	popped := make(chan string)
+	go func() {
+		v, _ := b.Pop(context.Background())
+		popped <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	b.Update(late, time.Now())
+	select {
+	case v := <-popped:
+		if v != "never" {
+			t.Errorf("expected never, got %s", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the update to wake the consumer")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	b.Push("hour", time.Now().Add(time.Hour))
+	if _, err := b.Pop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	if _, ok := b.TryPop(); ok || b.Len() != 1 {
+		t.Error("expected the value not to be due yet")
+	}
+}
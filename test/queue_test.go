@@ -1,7 +1,10 @@
 package test
 
 import (
+	"context"
+	"math/rand"
 	"testing"
+	"time"
 
 	"github.com/heqzha/goutils/container"
 )
@@ -40,3 +43,258 @@ func TestMtxGroupQueue(t *testing.T) {
 	t.Log("number of groups, after clear", q.GroupsLen())
 
 }
+
+func TestMtxGroupQueueFair(t *testing.T) {
+	q := container.MtxGroupQueue{}
+	q.Init()
+	if q.Len("unknown") != 0 {
+		t.Error("expected an unknown group to be empty")
+	}
+	q.Clear("unknown")
+
+	push := func(grp string, n int) {
+		for i := 0; i < n; i++ {
+			q.Push(grp, i)
+		}
+	}
+	pops := func() string {
+		order := ""
+		for {
+			grp, _, ok := q.PopFair()
+			if !ok {
+				return order
+			}
+			order += grp
+		}
+	}
+
+	push("a", 3)
+	push("b", 1)
+	push("c", 2)
+	if order := pops(); order != "abcaca" {
+		t.Errorf("expected round-robin order abcaca, got %s", order)
+	}
+	if q.GroupsLen() != 0 {
+		t.Errorf("expected empty groups to be removed, got %v", q.Groups())
+	}
+
+	q.SetWeight("a", 3)
+	push("a", 5)
+	push("b", 3)
+	if order := pops(); order != "aaabaabb" {
+		t.Errorf("expected weighted order aaabaabb, got %s", order)
+	}
+
+	q.SetCapacity("a", 2)
+	push("a", 2)
+	if err := q.TryPush("a", 3); err != container.ErrQueueFull {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	pushed := make(chan struct{})
+	go func() {
+		q.Push("a", 3)
+		close(pushed)
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("expected Push to wait for room")
+	case <-time.After(20 * time.Millisecond):
+	}
+	q.Pop("a")
+	<-pushed
+	q.Pop("a")
+	if err := q.TryPush("a", 4); err != nil || q.Len("a") != 2 {
+		t.Errorf("expected room after popping, got %v", err)
+	}
+
+	// Push keeps the signature it had before capacities.
+	var pushFunc func(string, interface{}) = q.Push
+	pushFunc("b", 1)
+}
+
+func TestDeque(t *testing.T) {
+	q := container.Deque[int]{}
+	if _, ok := q.Pop(); ok {
+		t.Fatal("expected an empty deque")
+	}
+	q.Push(2)
+	q.Push(3)
+	q.PushFront(1)
+	q.PushFront(0)
+	if v, _ := q.Peek(); v != 0 {
+		t.Errorf("expected 0 at the front, got %d", v)
+	}
+	if v, _ := q.PeekBack(); v != 3 {
+		t.Errorf("expected 3 at the back, got %d", v)
+	}
+	got := []int{}
+	q.All(func(i, v int) bool {
+		got = append(got, v)
+		return i < 2
+	})
+	if len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Errorf("unexpected iteration %v", got)
+	}
+
+	// Check random operations against a slice, through growing, wrapping
+	// around and shrinking.
+	model := []int{0, 1, 2, 3}
+	for i := 4; i < 1000; i++ {
+		q.Push(i)
+		model = append(model, i)
+	}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		grow := i < 5000
+		switch op := r.Intn(4); {
+		case op == 0 && grow || op == 1 && !grow && r.Intn(3) == 0:
+			q.Push(i)
+			model = append(model, i)
+		case op == 1 && grow:
+			q.PushFront(i)
+			model = append([]int{i}, model...)
+		case op == 2:
+			v, ok := q.Pop()
+			if ok != (len(model) > 0) || ok && v != model[0] {
+				t.Fatalf("step %d: Pop got %d %v", i, v, ok)
+			}
+			if ok {
+				model = model[1:]
+			}
+		default:
+			v, ok := q.PopBack()
+			if ok != (len(model) > 0) || ok && v != model[len(model)-1] {
+				t.Fatalf("step %d: PopBack got %d %v", i, v, ok)
+			}
+			if ok {
+				model = model[:len(model)-1]
+			}
+		}
+		if q.Len() != len(model) || len(model) > 0 && q.At(len(model)/2) != model[len(model)/2] {
+			t.Fatalf("step %d: deque diverged from %v", i, model)
+		}
+	}
+
+	old := container.Queue{}
+	old.Push("a")
+	old.Push(1)
+	if v := old.Pop(); v != "a" || old.Len() != 1 {
+		t.Errorf("unexpected Queue state %v %d", v, old.Len())
+	}
+	if old.At(0) != 1 {
+		t.Errorf("expected 1 at the front, got %v", old.At(0))
+	}
+	old.Clear()
+	if old.Pop() != nil {
+		t.Error("expected nil from an empty Queue")
+	}
+}
+
+func TestBlockingQueue(t *testing.T) {
+	q := container.NewBlockingQueue[int](2)
+	if _, ok := q.TryPop(); ok {
+		t.Fatal("expected an empty queue")
+	}
+
+	popped := make(chan int)
+	go func() {
+		v, _ := q.Pop(context.Background())
+		popped <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	q.Push(context.Background(), 1)
+	if v := <-popped; v != 1 {
+		t.Errorf("expected 1, got %d", v)
+	}
+
+	q.Push(context.Background(), 2)
+	q.TryPush(3)
+	if err := q.TryPush(4); err != container.ErrQueueFull {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Push(ctx, 4); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	pushed := make(chan error)
+	go func() {
+		pushed <- q.Push(context.Background(), 4)
+	}()
+	q.TryPop()
+	if err := <-pushed; err != nil {
+		t.Error(err)
+	}
+
+	q.Close()
+	if err := q.Push(context.Background(), 5); err != container.ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+	for _, expected := range []int{3, 4} {
+		if v, err := q.Pop(context.Background()); v != expected || err != nil {
+			t.Errorf("expected %d to be drained, got %d %v", expected, v, err)
+		}
+	}
+	if _, err := q.Pop(context.Background()); err != container.ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+
+	// Close wakes the consumers waiting on an empty queue.
+	q = container.NewBlockingQueue[int](0)
+	woken := make(chan error)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := q.Pop(context.Background())
+			woken <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	for i := 0; i < 3; i++ {
+		if err := <-woken; err != container.ErrQueueClosed {
+			t.Errorf("expected ErrQueueClosed, got %v", err)
+		}
+	}
+}
+
+func TestBlockingQueuePopBatch(t *testing.T) {
+	q := container.NewBlockingQueue[int](0)
+	for i := 0; i < 10; i++ {
+		q.Push(context.Background(), i)
+	}
+	batch, err := q.PopBatch(context.Background(), 4, time.Hour)
+	if err != nil || len(batch) != 4 || batch[0] != 0 || batch[3] != 3 {
+		t.Errorf("expected a full batch, got %v %v", batch, err)
+	}
+
+	start := time.Now()
+	batch, _ = q.PopBatch(context.Background(), 10, 20*time.Millisecond)
+	if len(batch) != 6 || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("expected a partial batch after 20ms, got %v after %s", batch, time.Since(start))
+	}
+
+	go func() {
+		for i := 0; i < 5; i++ {
+			time.Sleep(2 * time.Millisecond)
+			q.Push(context.Background(), i)
+		}
+	}()
+	batch, _ = q.PopBatch(context.Background(), 5, time.Second)
+	if len(batch) != 5 {
+		t.Errorf("expected the batch to fill up from the producer, got %v", batch)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.PopBatch(ctx, 5, time.Second); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+	q.Push(context.Background(), 1)
+	q.Close()
+	if batch, err := q.PopBatch(context.Background(), 5, time.Second); len(batch) != 1 || err != nil {
+		t.Errorf("expected the closed queue to be drained, got %v %v", batch, err)
+	}
+	if _, err := q.PopBatch(context.Background(), 5, time.Second); err != container.ErrQueueClosed {
+		t.Errorf("expected ErrQueueClosed, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+	"github.com/heqzha/goutils/db"
+)
+
+func TestRedisReadThrough(t *testing.T) {
+	stub, handler := startStubRedis(t)
+	cache := db.NewRedisReadThrough(handler, time.Minute)
+
+	var loads int32
+	gate := make(chan struct{})
+	load := func() (string, error) {
+		atomic.AddInt32(&loads, 1)
+		<-gate
+		return "value", nil
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := cache.Get("test_hot", load); v != "value" || err != nil {
+				t.Errorf("expected value, got %q %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+	if loads != 1 {
+		t.Errorf("expected a single load, got %d", loads)
+	}
+
+	if v, _ := cache.Get("test_hot", func() (string, error) {
+		return "", fmt.Errorf("expected a cache hit")
+	}); v != "value" {
+		t.Errorf("expected the cached value, got %q", v)
+	}
+	stub.mutex.Lock()
+	ttl := stub.call([]string{"PTTL", "test_hot"}).(int64)
+	stub.mutex.Unlock()
+	if ttl <= 0 || ttl > int64(time.Minute/time.Millisecond) {
+		t.Errorf("expected the key to expire within a minute, got %dms", ttl)
+	}
+
+	if _, err := cache.Get("test_missing", func() (string, error) {
+		return "", fmt.Errorf("not in mongo")
+	}); err == nil || err.Error() != "not in mongo" {
+		t.Errorf("expected the load error, got %v", err)
+	}
+}
+
+func TestRedisReadThroughShortTTLAndBreaker(t *testing.T) {
+	stub, handler := startStubRedis(t)
+	cache := db.NewRedisReadThrough(handler, 500*time.Millisecond)
+	if _, err := cache.Get("test_short", func() (string, error) { return "value", nil }); err != nil {
+		t.Fatal(err)
+	}
+	stub.mutex.Lock()
+	ttl := stub.call([]string{"PTTL", "test_short"}).(int64)
+	stub.mutex.Unlock()
+	if ttl <= 0 || ttl > 500 {
+		t.Errorf("expected the key to expire within 500ms, got %dms", ttl)
+	}
+
+	handler.Breaker = concurrency.NewCircuitBreaker("redis", concurrency.BreakerConfig{
+		Trip:        concurrency.TripAfterFailures(1),
+		OpenTimeout: time.Minute,
+	})
+	handler.Init("127.0.0.1:1")
+	cache.Get("test_short", func() (string, error) { return "value", nil })
+	if _, err := cache.Get("test_short", func() (string, error) {
+		return "", fmt.Errorf("expected the breaker to fail the read")
+	}); err != concurrency.ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/db"
+)
+
+// realRedis connects to the Redis server at GOUTILS_REDIS_ADDR, skipping the
+// test when it is not set. The stub replays the Lua scripts instead of
+// running them, so only a real server checks the scripts themselves.
+func realRedis(t *testing.T, keys ...string) *db.RedisHandler {
+	addr := os.Getenv("GOUTILS_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("GOUTILS_REDIS_ADDR is not set")
+	}
+	handler := &db.RedisHandler{}
+	handler.Init(addr)
+	t.Cleanup(handler.Close)
+	if err := handler.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		handler.Delete(key)
+	}
+	return handler
+}
+
+func TestRedisLimiter(t *testing.T) {
+	_, handler := startStubRedis(t)
+	testRedisLimiter(t, handler)
+}
+
+func TestRedisLimiterLua(t *testing.T) {
+	testRedisLimiter(t, realRedis(t, "test_limiter", "test_limiter_zero"))
+}
+
+func testRedisLimiter(t *testing.T, handler *db.RedisHandler) {
+	l := handler.NewLimiter("test_limiter", 3, 100*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if ok, err := l.Allow(); err != nil || !ok {
+			t.Fatalf("event %d: expected to be allowed, got %v %v", i, ok, err)
+		}
+	}
+	if ok, _ := l.Allow(); ok {
+		t.Error("expected the 4th event to be refused")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded, got %v", err)
+	}
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("expected to wait for the window to slide, waited %s", waited)
+	}
+
+	if _, err := handler.NewLimiter("test_limiter_zero", 0, time.Second).Allow(); err == nil {
+		t.Error("expected a zero limit to be an error")
+	}
+}
+
+func TestRedisMutex(t *testing.T) {
+	_, handler := startStubRedis(t)
+	testRedisMutex(t, handler)
+}
+
+func TestRedisMutexLua(t *testing.T) {
+	testRedisMutex(t, realRedis(t, "test_lock", "test_lock:fence"))
+}
+
+func testRedisMutex(t *testing.T, handler *db.RedisHandler) {
+	a := handler.NewMutex("test_lock", 60*time.Millisecond)
+	b := handler.NewMutex("test_lock", 60*time.Millisecond)
+
+	if ok, err := a.TryLock(); err != nil || !ok {
+		t.Fatalf("expected to take the lock, got %v %v", ok, err)
+	}
+	first := a.Token()
+	if ok, _ := b.TryLock(); ok {
+		t.Fatal("expected the lock to be taken")
+	}
+
+	// The lease outlives its ttl as long as it is renewed.
+	time.Sleep(200 * time.Millisecond)
+	if ok, _ := b.TryLock(); ok {
+		t.Fatal("expected the lease to be renewed")
+	}
+
+	locked := make(chan error)
+	go func() {
+		locked <- b.Lock(context.Background())
+	}()
+	if err := a.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-locked; err != nil {
+		t.Fatal(err)
+	}
+	if b.Token() <= first {
+		t.Errorf("expected the fencing token to grow, got %d after %d", b.Token(), first)
+	}
+	if err := a.Unlock(); err != db.ErrLockNotHeld {
+		t.Errorf("expected ErrLockNotHeld, got %v", err)
+	}
+
+	// Someone else taking over the key makes b lose its lease.
+	handler.Delete("test_lock")
+	select {
+	case <-b.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expected the lease to be lost")
+	}
+	if ok, _ := a.TryLock(); !ok {
+		t.Fatal("expected the lock to be free")
+	}
+	// b no longer thinks it holds the lock and competes for it again.
+	if ok, err := b.TryLock(); ok || err != nil {
+		t.Fatalf("expected b to find the lock taken, got %v %v", ok, err)
+	}
+	if b.Token() != 0 {
+		t.Error("expected b to hold no lease")
+	}
+	select {
+	case <-b.Lost():
+	default:
+		t.Error("expected Lost to stay closed after the lease is dropped")
+	}
+	if err := b.Unlock(); err != db.ErrLockNotHeld {
+		t.Errorf("expected ErrLockNotHeld, got %v", err)
+	}
+	if ok, _ := a.TryLock(); ok || a.Token() == 0 {
+		t.Error("expected a to still hold the lock")
+	}
+	a.Unlock()
+}
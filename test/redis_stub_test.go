@@ -0,0 +1,312 @@
+package test
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/db"
+)
+
+// stubRedis is an in-process stand-in for a Redis server speaking RESP. It
+// only knows the commands used by the db package and, instead of running Lua,
+// replays the scripts of the db package recognised by their first line.
+type stubRedis struct {
+	ln      net.Listener
+	mutex   *sync.Mutex
+	strs    map[string]string
+	zsets   map[string]map[string]float64
+	expires map[string]time.Time
+	scripts map[string]string
+}
+
+type stubStatus string
+
+func startStubRedis(t *testing.T) (*stubRedis, *db.RedisHandler) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &stubRedis{
+		ln:      ln,
+		mutex:   &sync.Mutex{},
+		strs:    make(map[string]string),
+		zsets:   make(map[string]map[string]float64),
+		expires: make(map[string]time.Time),
+		scripts: make(map[string]string),
+	}
+	go s.serve()
+
+	handler := &db.RedisHandler{}
+	handler.Init(ln.Addr().String())
+	t.Cleanup(func() {
+		handler.Close()
+		ln.Close()
+	})
+	return s, handler
+}
+
+func (s *stubRedis) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *stubRedis) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mutex.Lock()
+		reply := s.call(args)
+		s.mutex.Unlock()
+		writeReply(w, reply)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case stubStatus:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
+
+// alive drops key if its expiry has passed.
+func (s *stubRedis) alive(key string) {
+	if at, ok := s.expires[key]; ok && !time.Now().Before(at) {
+		delete(s.strs, key)
+		delete(s.zsets, key)
+		delete(s.expires, key)
+	}
+}
+
+func stubScore(s string) float64 {
+	switch s {
+	case "-inf":
+		return math.Inf(-1)
+	case "+inf":
+		return math.Inf(1)
+	}
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func (s *stubRedis) call(args []string) interface{} {
+	cmd := strings.ToUpper(args[0])
+	if len(args) > 1 {
+		s.alive(args[1])
+	}
+	switch cmd {
+	case "PING":
+		return stubStatus("PONG")
+	case "GET":
+		if v, ok := s.strs[args[1]]; ok {
+			return v
+		}
+		return nil
+	case "SET":
+		key := args[1]
+		_, exists := s.strs[key]
+		var ttl time.Duration
+		for i := 3; i < len(args); i++ {
+			switch strings.ToUpper(args[i]) {
+			case "NX":
+				if exists {
+					return nil
+				}
+			case "PX":
+				i++
+				ms, _ := strconv.Atoi(args[i])
+				ttl = time.Duration(ms) * time.Millisecond
+			}
+		}
+		s.strs[key] = args[2]
+		delete(s.expires, key)
+		if ttl > 0 {
+			s.expires[key] = time.Now().Add(ttl)
+		}
+		return stubStatus("OK")
+	case "DEL":
+		_, ok1 := s.strs[args[1]]
+		_, ok2 := s.zsets[args[1]]
+		delete(s.strs, args[1])
+		delete(s.zsets, args[1])
+		delete(s.expires, args[1])
+		if ok1 || ok2 {
+			return int64(1)
+		}
+		return int64(0)
+	case "INCR":
+		n, _ := strconv.ParseInt(s.strs[args[1]], 10, 64)
+		n++
+		s.strs[args[1]] = strconv.FormatInt(n, 10)
+		return n
+	case "EXPIRE", "PEXPIRE":
+		_, ok1 := s.strs[args[1]]
+		_, ok2 := s.zsets[args[1]]
+		if !ok1 && !ok2 {
+			return int64(0)
+		}
+		n, _ := strconv.Atoi(args[2])
+		unit := time.Millisecond
+		if cmd == "EXPIRE" {
+			unit = time.Second
+		}
+		s.expires[args[1]] = time.Now().Add(time.Duration(n) * unit)
+		return int64(1)
+	case "PTTL":
+		if _, ok := s.strs[args[1]]; !ok {
+			return int64(-2)
+		}
+		at, ok := s.expires[args[1]]
+		if !ok {
+			return int64(-1)
+		}
+		return int64(time.Until(at) / time.Millisecond)
+	case "ZADD":
+		if s.zsets[args[1]] == nil {
+			s.zsets[args[1]] = make(map[string]float64)
+		}
+		s.zsets[args[1]][args[3]] = stubScore(args[2])
+		return int64(1)
+	case "ZCARD":
+		return int64(len(s.zsets[args[1]]))
+	case "ZREMRANGEBYSCORE":
+		min, max := stubScore(args[2]), stubScore(args[3])
+		removed := int64(0)
+		for member, score := range s.zsets[args[1]] {
+			if score >= min && score <= max {
+				delete(s.zsets[args[1]], member)
+				removed++
+			}
+		}
+		return removed
+	case "ZRANGE":
+		members := []string{}
+		zset := s.zsets[args[1]]
+		for member := range zset {
+			members = append(members, member)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			return zset[members[i]] < zset[members[j]]
+		})
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		if stop < 0 || stop >= len(members) {
+			stop = len(members) - 1
+		}
+		res := []interface{}{}
+		for i := start; i <= stop; i++ {
+			res = append(res, members[i])
+			if len(args) > 4 {
+				res = append(res, strconv.FormatFloat(zset[members[i]], 'f', -1, 64))
+			}
+		}
+		return res
+	case "EVAL":
+		sum := sha1.Sum([]byte(args[1]))
+		s.scripts[hex.EncodeToString(sum[:])] = args[1]
+		return s.eval(args[1], args[2:])
+	case "EVALSHA":
+		src, ok := s.scripts[args[1]]
+		if !ok {
+			return fmt.Errorf("NOSCRIPT No matching script.")
+		}
+		return s.eval(src, args[2:])
+	}
+	return fmt.Errorf("ERR unknown command '%s'", args[0])
+}
+
+// eval replays the script src given its key count, keys and arguments.
+func (s *stubRedis) eval(src string, args []string) interface{} {
+	n, _ := strconv.Atoi(args[0])
+	keys, argv := args[1:1+n], args[1+n:]
+	switch strings.SplitN(src, "\n", 2)[0] {
+	case "-- goutils:limiter":
+		now := float64(time.Now().UnixNano() / int64(time.Millisecond))
+		window := stubScore(argv[0])
+		limit, _ := strconv.Atoi(argv[1])
+		s.call([]string{"ZREMRANGEBYSCORE", keys[0], "-inf", fmt.Sprint(now - window)})
+		if len(s.zsets[keys[0]]) < limit {
+			s.call([]string{"ZADD", keys[0], fmt.Sprint(now), argv[2]})
+			s.call([]string{"PEXPIRE", keys[0], argv[0]})
+			return int64(0)
+		}
+		oldest := s.call([]string{"ZRANGE", keys[0], "0", "0", "WITHSCORES"}).([]interface{})
+		return int64(math.Max(stubScore(oldest[1].(string))+window-now, 1))
+	case "-- goutils:lock-acquire":
+		if s.call([]string{"SET", keys[0], argv[0], "NX", "PX", argv[1]}) == nil {
+			return int64(0)
+		}
+		return s.call([]string{"INCR", keys[1]})
+	case "-- goutils:lock-renew":
+		if s.call([]string{"GET", keys[0]}) == argv[0] {
+			return s.call([]string{"PEXPIRE", keys[0], argv[1]})
+		}
+		return int64(0)
+	case "-- goutils:lock-release":
+		if s.call([]string{"GET", keys[0]}) == argv[0] {
+			return s.call([]string{"DEL", keys[0]})
+		}
+		return int64(0)
+	}
+	return fmt.Errorf("ERR script not supported by the stub")
+}
@@ -1,10 +1,12 @@
 package test
 
+import "errors"
 import "testing"
 import "github.com/heqzha/goutils/db"
 import "strconv"
 
 import "time"
+import "github.com/heqzha/goutils/concurrency"
 
 func TestRedisHandlerInit(t *testing.T) {
 	handler := &db.RedisHandler{}
@@ -259,3 +261,75 @@ func TestRedisHandlerL(t *testing.T) {
 		t.Log(data)
 	}
 }
+
+func TestRedisHandlerBreaker(t *testing.T) {
+	_, handler := startStubRedis(t)
+	handler.Breaker = concurrency.NewCircuitBreaker("redis", concurrency.BreakerConfig{
+		Trip:        concurrency.TripAfterFailures(2),
+		OpenTimeout: time.Minute,
+	})
+
+	// The stub answers LLEN with an error reply, which is not a failure.
+	for i := 0; i < 3; i++ {
+		if _, err := handler.Llen("test_breaker"); err == nil {
+			t.Fatal("expected an error reply")
+		}
+	}
+	if handler.Breaker.State() != concurrency.StateClosed {
+		t.Fatal("expected error replies not to trip the breaker")
+	}
+
+	handler.Init("127.0.0.1:1")
+	for i := 0; i < 2; i++ {
+		if _, err := handler.Llen("test_breaker"); err == nil {
+			t.Fatal("expected a connection error")
+		}
+	}
+	if _, err := handler.Llen("test_breaker"); err != concurrency.ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestRedisHandlerBreakerAllCommands(t *testing.T) {
+	_, handler := startStubRedis(t)
+	handler.Breaker = concurrency.NewCircuitBreaker("redis", concurrency.BreakerConfig{
+		Trip:        concurrency.TripAfterFailures(2),
+		OpenTimeout: time.Minute,
+	})
+	if err := handler.Set("test_breaker_key", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := handler.Get("test_breaker_key"); err != nil || v != "v" {
+		t.Fatalf("expected v, got %q %v", v, err)
+	}
+
+	handler.Init("127.0.0.1:1")
+	handler.Get("test_breaker_key")
+	handler.Set("test_breaker_key", "v")
+	if handler.Breaker.State() != concurrency.StateOpen {
+		t.Fatal("expected Get and Set failures to trip the breaker")
+	}
+	if _, err := handler.Get("test_breaker_key"); !errors.Is(err, concurrency.ErrCircuitOpen) {
+		t.Errorf("expected Get to fail with ErrCircuitOpen, got %v", err)
+	}
+	if err := handler.Set("test_breaker_key", "v"); !errors.Is(err, concurrency.ErrCircuitOpen) {
+		t.Errorf("expected Set to fail with ErrCircuitOpen, got %v", err)
+	}
+	if _, err := handler.NewLimiter("test_breaker_limiter", 1, time.Second).Allow(); !errors.Is(err, concurrency.ErrCircuitOpen) {
+		t.Errorf("expected scripts to fail with ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestRedisHandlerBreakerIsFailure(t *testing.T) {
+	_, handler := startStubRedis(t)
+	handler.Breaker = concurrency.NewCircuitBreaker("redis", concurrency.BreakerConfig{
+		Trip:        concurrency.TripAfterFailures(2),
+		OpenTimeout: time.Minute,
+		IsFailure:   func(err error) bool { return err != nil },
+	})
+	handler.Llen("test_breaker")
+	handler.Llen("test_breaker")
+	if _, err := handler.Llen("test_breaker"); err != concurrency.ErrCircuitOpen {
+		t.Errorf("expected the configured IsFailure to count error replies, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+	"github.com/heqzha/goutils/net"
+	"github.com/heqzha/goutils/retry"
+	"gopkg.in/mgo.v2"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	exp := retry.Exponential(10*time.Millisecond, 50*time.Millisecond)
+	for i, expected := range []time.Duration{10, 20, 40, 50, 50} {
+		if d := exp(i+1, 0); d != expected*time.Millisecond {
+			t.Errorf("attempt %d: expected %s, got %s", i+1, expected*time.Millisecond, d)
+		}
+	}
+	if d := retry.Constant(time.Second)(7, 0); d != time.Second {
+		t.Errorf("expected 1s, got %s", d)
+	}
+
+	jitter := retry.DecorrelatedJitter(10*time.Millisecond, time.Second)
+	last := time.Duration(0)
+	for i := 1; i <= 20; i++ {
+		d := jitter(i, last)
+		if d < 10*time.Millisecond || d > time.Second || (last > 0 && d > 3*last) {
+			t.Fatalf("attempt %d: delay %s out of range after %s", i, d, last)
+		}
+		last = d
+	}
+}
+
+func TestRetryClassification(t *testing.T) {
+	cases := []struct {
+		err       error
+		attempts  int
+		retryable bool
+	}{
+		{&net.StatusError{URL: "u", StatusCode: 503}, 4, true},
+		{&net.StatusError{URL: "u", StatusCode: 429}, 4, true},
+		{&net.StatusError{URL: "u", StatusCode: 404}, 1, false},
+		{mgo.ErrNotFound, 1, false},
+		{retry.Permanent(fmt.Errorf("bad input")), 1, false},
+		{fmt.Errorf("connection reset"), 4, true},
+	}
+	p := retry.Policy{Backoff: retry.Constant(0), MaxAttempts: 4}
+	for _, c := range cases {
+		if retry.IsRetryable(c.err) != c.retryable {
+			t.Errorf("%v: expected retryable %v", c.err, c.retryable)
+		}
+		attempts := 0
+		err := p.Do(context.Background(), func(context.Context) error {
+			attempts++
+			return c.err
+		})
+		if attempts != c.attempts || err == nil || err.Error() != c.err.Error() {
+			t.Errorf("%v: expected %d attempts, got %d and %v", c.err, c.attempts, attempts, err)
+		}
+	}
+	if err := p.Do(context.Background(), func(context.Context) error {
+		return retry.Permanent(mgo.ErrNotFound)
+	}); err != mgo.ErrNotFound {
+		t.Errorf("expected Permanent to be unwrapped, got %v", err)
+	}
+}
+
+func TestRetryLimits(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	attempts := 0
+	retries := []time.Duration{}
+	p := retry.Policy{
+		Backoff:    retry.Constant(0),
+		MaxElapsed: 25 * time.Second,
+		Clock:      clock,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			retries = append(retries, delay)
+		},
+	}
+	p.Do(context.Background(), func(context.Context) error {
+		attempts++
+		clock.Advance(10 * time.Second)
+		return fmt.Errorf("down")
+	})
+	if attempts != 3 || len(retries) != 2 {
+		t.Errorf("expected 3 attempts within 25s, got %d", attempts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p = retry.Policy{
+		Backoff:     retry.Constant(time.Hour),
+		MaxAttempts: 5,
+		OnRetry: func(int, error, time.Duration) {
+			cancel()
+		},
+	}
+	if err := p.Do(ctx, func(context.Context) error { return fmt.Errorf("down") }); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestRetryHTTP(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	p := retry.Policy{Backoff: retry.Exponential(time.Millisecond, 10*time.Millisecond), MaxAttempts: 5}
+	body, err := retry.DoValue(context.Background(), p, func(context.Context) ([]byte, error) {
+		return net.HTTPPostV1(server.URL, nil, nil, nil, time.Second)
+	})
+	if err != nil || string(body) != "ok" || calls != 3 {
+		t.Errorf("expected ok after 3 calls, got %q %v after %d", body, err, calls)
+	}
+}
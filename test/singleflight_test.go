@@ -0,0 +1,76 @@
+package test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+)
+
+func TestSingleflight(t *testing.T) {
+	g := concurrency.NewSingleflight[int]()
+	var calls int32
+	gate := make(chan struct{})
+	fn := func() (int, error) {
+		atomic.AddInt32(&calls, 1)
+		<-gate
+		return 42, nil
+	}
+
+	first := g.DoChan("key", fn)
+	wg := &sync.WaitGroup{}
+	shared := int32(0)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := g.Do("key", fn)
+			if v != 42 || err != nil {
+				t.Errorf("expected 42, got %d %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	// Let the callers pile up on the flight before releasing it.
+	time.Sleep(20 * time.Millisecond)
+	close(gate)
+	wg.Wait()
+	if res := <-first; res.Val != 42 || !res.Shared {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if calls != 1 || shared != 10 {
+		t.Errorf("expected 1 call shared by 10 callers, got %d calls, %d shared", calls, shared)
+	}
+
+	if _, _, s := g.Do("key", func() (int, error) { return 1, nil }); s {
+		t.Error("expected a new call once the flight has landed")
+	}
+}
+
+func TestSingleflightForgetAndPanic(t *testing.T) {
+	g := concurrency.NewSingleflight[string]()
+	gate := make(chan struct{})
+	slow := g.DoChan("key", func() (string, error) {
+		<-gate
+		return "old", nil
+	})
+	g.Forget("key")
+	if v, _, _ := g.Do("key", func() (string, error) { return "new", nil }); v != "new" {
+		t.Errorf("expected Forget to start a new call, got %s", v)
+	}
+	close(gate)
+	if res := <-slow; res.Val != "old" {
+		t.Errorf("expected the forgotten call to complete, got %+v", res)
+	}
+
+	_, err, _ := g.Do("panic", func() (string, error) {
+		panic("boom")
+	})
+	if _, ok := err.(*concurrency.PanicError); !ok {
+		t.Errorf("expected a *PanicError, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+)
+
+func TestParseCron(t *testing.T) {
+	loc := time.UTC
+	// Friday 2024-03-15 17:50
+	from := time.Date(2024, 3, 15, 17, 50, 30, 0, loc)
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"*/15 9-17 * * mon-fri", time.Date(2024, 3, 18, 9, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, loc)},
+		{"@hourly", time.Date(2024, 3, 15, 18, 0, 0, 0, loc)},
+		{"30 8 29 feb *", time.Date(2028, 2, 29, 8, 30, 0, 0, loc)},
+		{"0 12 * * 7", time.Date(2024, 3, 17, 12, 0, 0, 0, loc)},
+		{"0 0 13 * fri", time.Date(2024, 3, 22, 0, 0, 0, 0, loc)},
+		{"@every 90s", from.Add(90 * time.Second)},
+	}
+	for _, c := range cases {
+		s, err := concurrency.ParseCron(c.spec)
+		if err != nil {
+			t.Errorf("%s: %v", c.spec, err)
+			continue
+		}
+		if next := s.Next(from); !next.Equal(c.next) {
+			t.Errorf("%s: expected %s, got %s", c.spec, c.next, next)
+		}
+	}
+
+	for _, spec := range []string{"* * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "@every -1s"} {
+		if _, err := concurrency.ParseCron(spec); err == nil {
+			t.Errorf("%s: expected parse error", spec)
+		}
+	}
+	if s, _ := concurrency.ParseCron("0 0 30 2 *"); !s.Next(from).IsZero() {
+		t.Error("expected impossible schedule to never fire")
+	}
+}
+
+func waitRuns(t *testing.T, s *concurrency.Scheduler, name string, n int) concurrency.TaskStatus {
+	deadline := time.Now().Add(time.Second)
+	for {
+		status, err := s.Status(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(status.History) >= n && !status.Running {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: expected %d runs, got %d", name, n, len(status.History))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := concurrency.NewScheduler(clock)
+	defer s.StopAll()
+
+	runs := 0
+	if err := s.AddInterval("tick", 10*time.Second, func(context.Context) error {
+		runs++
+		return fmt.Errorf("run %d", runs)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddInterval("tick", time.Second, nil); err == nil {
+		t.Error("expected duplicate task to be rejected")
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	status := waitRuns(t, s, "tick", 1)
+	if status.History[0].Err == nil || status.History[0].Err.Error() != "run 1" {
+		t.Errorf("unexpected history %+v", status.History)
+	}
+
+	s.Pause("tick")
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	s.RunNow("tick")
+	waitRuns(t, s, "tick", 2)
+	s.Resume("tick")
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Second)
+	status = waitRuns(t, s, "tick", 3)
+	if runs != 3 || status.Paused {
+		t.Errorf("expected 3 runs, got %d: %+v", runs, status)
+	}
+
+	if err := s.Stop("tick"); err != nil {
+		t.Error(err)
+	}
+	if _, err := s.Status("tick"); err == nil {
+		t.Error("expected stopped task to be removed")
+	}
+}
+
+func TestSchedulerPanicAndOverlap(t *testing.T) {
+	clock := concurrency.NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := concurrency.NewScheduler(clock)
+	defer s.StopAll()
+
+	s.AddCron("panic", "* * * * *", func(context.Context) error {
+		panic("boom")
+	})
+	gate := make(chan struct{})
+	started := make(chan struct{}, 10)
+	s.AddInterval("slow", time.Minute, func(context.Context) error {
+		started <- struct{}{}
+		<-gate
+		return nil
+	})
+
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	status := waitRuns(t, s, "panic", 1)
+	if _, ok := status.History[0].Err.(*concurrency.PanicError); !ok {
+		t.Errorf("expected a *PanicError, got %v", status.History[0].Err)
+	}
+
+	<-started
+	clock.BlockUntil(2)
+	clock.Advance(time.Minute)
+	waitRuns(t, s, "panic", 2)
+	close(gate)
+	status = waitRuns(t, s, "slow", 1)
+	if len(started) != 0 || len(status.History) != 1 {
+		t.Errorf("expected the overlapping activation to be skipped, got %d runs", len(status.History))
+	}
+}
+
+func TestSchedulerStopAllWaitsForRuns(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		s := concurrency.NewScheduler(nil)
+		var active, total int32
+		run := func(context.Context) error {
+			atomic.AddInt32(&active, 1)
+			atomic.AddInt32(&total, 1)
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			return nil
+		}
+		names := []string{"a", "b", "c"}
+		for _, name := range names {
+			s.AddInterval(name, time.Hour, run, concurrency.AllowOverlap())
+		}
+		stop := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				for _, name := range names {
+					s.RunNow(name)
+				}
+				runtime.Gosched()
+			}
+		}()
+		time.Sleep(2 * time.Millisecond)
+		s.StopAll()
+		if n := atomic.LoadInt32(&active); n != 0 {
+			t.Fatalf("round %d: StopAll returned with %d runs in progress", round, n)
+		}
+		n := atomic.LoadInt32(&total)
+		time.Sleep(5 * time.Millisecond)
+		close(stop)
+		if atomic.LoadInt32(&total) != n {
+			t.Fatalf("round %d: a run started after StopAll returned", round)
+		}
+	}
+}
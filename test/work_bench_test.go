@@ -0,0 +1,181 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+	"github.com/heqzha/goutils/container"
+)
+
+// legacyPool reproduces the polling dispatcher WorkersPool used before the
+// shared queue, so both can be benchmarked side by side.
+type legacyPool struct {
+	container.Queue
+	q     chan legacyWork
+	quit  chan bool
+	mutex *sync.Mutex
+}
+
+type legacyWork struct {
+	f      func()
+	params interface{}
+}
+
+type legacyWorker struct {
+	q     chan legacyWork
+	busy  bool
+	mutex *sync.RWMutex
+	quit  chan bool
+}
+
+func (w *legacyWorker) available() bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return !w.busy
+}
+
+func (w *legacyWorker) setBusy(busy bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.busy = busy
+}
+
+func (lp *legacyPool) start(nWorkers, maxBuffer int) {
+	lp.q = make(chan legacyWork, maxBuffer)
+	lp.quit = make(chan bool)
+	lp.mutex = &sync.Mutex{}
+	for i := 0; i < nWorkers; i++ {
+		w := &legacyWorker{
+			q:     make(chan legacyWork, 1),
+			mutex: &sync.RWMutex{},
+			quit:  lp.quit,
+		}
+		go func() {
+			for {
+				select {
+				case work := <-w.q:
+					w.setBusy(true)
+					work.f()
+					w.setBusy(false)
+				case <-w.quit:
+					return
+				}
+			}
+		}()
+		lp.Push(w)
+	}
+
+	go func() {
+		for {
+			select {
+			case work := <-lp.q:
+				go func() {
+					lp.mutex.Lock()
+					w := lp.Pop().(*legacyWorker)
+					if w.available() {
+						w.q <- work
+					} else {
+						time.Sleep(time.Millisecond * 50)
+						lp.push(work)
+					}
+					lp.Push(w)
+					lp.mutex.Unlock()
+				}()
+			case <-lp.quit:
+				return
+			}
+		}
+	}()
+}
+
+func (lp *legacyPool) push(work legacyWork) error {
+	if len(lp.q) >= cap(lp.q) {
+		return fmt.Errorf("full")
+	}
+	lp.q <- work
+	return nil
+}
+
+func (lp *legacyPool) stop() {
+	close(lp.quit)
+}
+
+const (
+	benchWorkers = 8
+	benchBuffer  = 1024
+	benchJobs    = 256
+	benchWait    = 5 * time.Second
+)
+
+// waitJobs waits for wg and reports how many of n jobs never ran.
+func waitJobs(wg *sync.WaitGroup, ran *int64, n int) int {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return 0
+	case <-time.After(benchWait):
+		return n - int(atomic.LoadInt64(ran))
+	}
+}
+
+func BenchmarkWorkersPoolThroughput(b *testing.B) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(benchWorkers, benchBuffer)
+	defer wp.Stop()
+
+	var latency, ran int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg := &sync.WaitGroup{}
+		wg.Add(benchJobs)
+		for j := 0; j < benchJobs; j++ {
+			submitted := time.Now()
+			wp.Collect(func(interface{}) interface{} {
+				atomic.AddInt64(&latency, int64(time.Since(submitted)))
+				atomic.AddInt64(&ran, 1)
+				wg.Done()
+				return nil
+			}, nil, 0)
+		}
+		if lost := waitJobs(wg, &ran, benchJobs); lost > 0 {
+			b.Fatalf("%d jobs lost", lost)
+		}
+		atomic.StoreInt64(&ran, 0)
+	}
+	b.ReportMetric(float64(latency)/float64(b.N*benchJobs), "ns/job-latency")
+}
+
+func BenchmarkLegacyPoolThroughput(b *testing.B) {
+	lp := legacyPool{}
+	lp.start(benchWorkers, benchBuffer)
+	defer lp.stop()
+
+	var latency, ran, lost int64
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg := &sync.WaitGroup{}
+		wg.Add(benchJobs)
+		for j := 0; j < benchJobs; j++ {
+			submitted := time.Now()
+			lp.push(legacyWork{f: func() {
+				atomic.AddInt64(&latency, int64(time.Since(submitted)))
+				atomic.AddInt64(&ran, 1)
+				wg.Done()
+			}})
+		}
+		// Jobs dropped by the legacy re-queue never run; count them instead
+		// of hanging the benchmark.
+		lost += int64(waitJobs(wg, &ran, benchJobs))
+		atomic.StoreInt64(&ran, 0)
+	}
+	b.ReportMetric(float64(latency)/float64(b.N*benchJobs), "ns/job-latency")
+	b.ReportMetric(float64(lost)/float64(b.N), "lost/op")
+}
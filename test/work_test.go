@@ -0,0 +1,577 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/heqzha/goutils/concurrency"
+)
+
+func TestWorkersPoolShutdownDrain(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(4, 100)
+
+	var done int64
+	for i := 0; i < 20; i++ {
+		err := wp.Collect(func(interface{}) interface{} {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt64(&done, 1)
+			return nil
+		}, i, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	report, err := wp.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Completed != 20 || atomic.LoadInt64(&done) != 20 {
+		t.Fatalf("expected 20 completed jobs, got %+v", report)
+	}
+	if err := wp.Collect(func(interface{}) interface{} { return nil }, nil, 0); err == nil {
+		t.Error("expected submission to be rejected after shutdown")
+	}
+	t.Logf("%+v", report)
+}
+
+func TestWorkersPoolShutdownDeadline(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(1, 10)
+
+	for i := 0; i < 5; i++ {
+		wp.Collect(func(interface{}) interface{} {
+			time.Sleep(100 * time.Millisecond)
+			return nil
+		}, i, 0)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err := wp.Shutdown(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if report.Abandoned == 0 {
+		t.Errorf("expected abandoned jobs, got %+v", report)
+	}
+	t.Logf("%+v", report)
+}
+
+func TestWorkersPoolJobContext(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(1, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := wp.CollectWithContext(ctx, func(interface{}) interface{} { return nil }, nil, 0); err == nil {
+		t.Error("expected submission with a cancelled context to fail")
+	}
+
+	poolCtx, poolCancel := context.WithCancel(context.Background())
+	wp2 := concurrency.WorkersPool{}
+	wp2.StartWithContext(poolCtx, 1, 10)
+	poolCancel()
+	if err := wp2.Collect(func(interface{}) interface{} { return nil }, nil, 0); err == nil {
+		t.Error("expected submission to a cancelled pool to fail")
+	}
+
+	wp.Stop()
+	wp2.Stop()
+}
+
+func TestWorkersPoolFutures(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(4, 100)
+	defer wp.Stop()
+
+	ctx := context.Background()
+	futures := []*concurrency.Future[int]{}
+	for i := 0; i < 10; i++ {
+		n := i
+		f, err := concurrency.Submit(&wp, ctx, func(context.Context) (int, error) {
+			return n * n, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures = append(futures, f)
+	}
+	results, err := concurrency.WaitAll(ctx, futures...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r != i*i {
+			t.Errorf("result %d: expected %d, got %d", i, i*i, r)
+		}
+	}
+
+	f, _ := concurrency.Submit(&wp, ctx, func(context.Context) (int, error) {
+		panic("boom")
+	})
+	if _, err := f.Wait(ctx); err == nil {
+		t.Error("expected panic to be reported")
+	} else if _, ok := err.(*concurrency.PanicError); !ok {
+		t.Errorf("expected *PanicError, got %T", err)
+	}
+
+	slow, _ := concurrency.Submit(&wp, ctx, func(context.Context) (int, error) {
+		time.Sleep(200 * time.Millisecond)
+		return 1, nil
+	})
+	fast, _ := concurrency.Submit(&wp, ctx, func(context.Context) (int, error) {
+		return 2, nil
+	})
+	i, r, err := concurrency.WaitAny(ctx, slow, fast)
+	if err != nil || i != 1 || r != 2 {
+		t.Errorf("expected fast future to win, got %d %d %v", i, r, err)
+	}
+}
+
+func TestWorkersPoolPanicRecovery(t *testing.T) {
+	panics := make(chan *concurrency.PanicError, 1)
+	wp := concurrency.WorkersPool{
+		PanicHandler: func(perr *concurrency.PanicError) {
+			panics <- perr
+		},
+	}
+	wp.Start(1, 10)
+
+	output := make(chan interface{}, 1)
+	wp.CollectWithOutput(func(interface{}) interface{} {
+		panic("boom")
+	}, "job-1", 0, output)
+	select {
+	case perr := <-panics:
+		if perr.JobID == 0 || perr.Params != "job-1" || len(perr.Stack) == 0 {
+			t.Errorf("expected job identity and stack, got %+v", perr)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("panic handler was not called")
+	}
+	if perr, ok := (<-output).(*concurrency.PanicError); !ok || perr.Params != "job-1" {
+		t.Errorf("expected the panic on the output, got %v", perr)
+	}
+
+	wp.CollectWithOutput(func(p interface{}) interface{} {
+		return p
+	}, "alive", 0, output)
+	select {
+	case out := <-output:
+		if out != "alive" {
+			t.Errorf("unexpected output %v", out)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker was not respawned after panic")
+	}
+
+	report, _ := wp.Shutdown(context.Background())
+	if report.Panicked != 1 || report.Completed != 1 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestWorkersPoolFIFO(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(1, 100)
+	defer wp.Stop()
+
+	output := make(chan interface{}, 100)
+	for i := 0; i < 100; i++ {
+		if err := wp.CollectWithOutput(func(p interface{}) interface{} {
+			return p
+		}, i, 0, output); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if out := <-output; out != i {
+			t.Fatalf("expected job %d, got %v", i, out)
+		}
+	}
+}
+
+func TestWorkersPoolLanes(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	err := wp.StartWithLanes(context.Background(), 1, []concurrency.Lane{
+		{Name: concurrency.DefaultLane, Weight: 1, MaxDepth: 10},
+		{Name: "interactive", Weight: 3, MaxDepth: 10},
+		{Name: "backfill", Weight: 1, MaxDepth: 4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wp.Stop()
+
+	gate := make(chan struct{})
+	wp.Collect(func(interface{}) interface{} {
+		<-gate
+		return nil
+	}, nil, 0)
+
+	ctx := context.Background()
+	output := make(chan interface{}, 20)
+	identity := func(p interface{}) interface{} { return p }
+	for i := 0; i < 8; i++ {
+		if err := wp.CollectWithOutputContext(ctx, identity, "interactive", 0, output, concurrency.OnLane("interactive")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := wp.CollectWithOutputContext(ctx, identity, "backfill", 0, output, concurrency.OnLane("backfill")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := wp.CollectWithOutputContext(ctx, identity, "backfill", 0, output, concurrency.OnLane("backfill")); err == nil {
+		t.Error("expected backfill lane to be full")
+	}
+	if err := wp.CollectWithContext(ctx, identity, nil, 0, concurrency.OnLane("unknown")); err == nil {
+		t.Error("expected unknown lane to be rejected")
+	}
+	close(gate)
+
+	counts := map[interface{}]int{}
+	for i := 0; i < 8; i++ {
+		counts[<-output]++
+	}
+	if counts["interactive"] != 6 || counts["backfill"] != 2 {
+		t.Errorf("expected a 3:1 split in the first 8 jobs, got %v", counts)
+	}
+}
+
+func TestWorkersPoolPolicies(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(1, 1)
+	defer wp.Stop()
+
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	wp.Collect(func(interface{}) interface{} {
+		close(started)
+		<-gate
+		return nil
+	}, nil, 0)
+	<-started
+
+	ctx := context.Background()
+	output := make(chan interface{}, 10)
+	identity := func(p interface{}) interface{} { return p }
+	wp.CollectWithOutput(identity, "first", 0, output)
+
+	if err := wp.CollectWithOutput(identity, "rejected", 0, output); err != concurrency.ErrWorkQueueFull {
+		t.Errorf("expected ErrWorkQueueFull, got %v", err)
+	}
+	if err := wp.CollectWithOutputContext(ctx, identity, "timeout", 0, output, concurrency.WithBlockTimeout(20*time.Millisecond)); err != concurrency.ErrWorkQueueFull {
+		t.Errorf("expected blocked submission to time out, got %v", err)
+	}
+	if err := wp.CollectWithOutputContext(ctx, identity, "caller", 0, output, concurrency.WithPolicy(concurrency.PolicyCallerRuns)); err != nil {
+		t.Error(err)
+	} else if out := <-output; out != "caller" {
+		t.Errorf("expected work to run in caller, got %v", out)
+	}
+
+	dropped, _ := concurrency.Submit(&wp, ctx, func(context.Context) (string, error) {
+		return "dropped", nil
+	}, concurrency.WithPolicy(concurrency.PolicyDropOldest))
+	if dropped == nil {
+		t.Fatal("expected drop-oldest submission to succeed")
+	}
+	// "first" was evicted by the future, which in turn is evicted here.
+	if err := wp.CollectWithOutputContext(ctx, identity, "newest", 0, output, concurrency.WithPolicy(concurrency.PolicyDropOldest)); err != nil {
+		t.Error(err)
+	}
+	if _, err := dropped.Wait(ctx); err != concurrency.ErrWorkDropped {
+		t.Errorf("expected ErrWorkDropped, got %v", err)
+	}
+
+	blocked := make(chan error)
+	go func() {
+		blocked <- wp.CollectWithOutputContext(ctx, identity, "blocked", 0, output, concurrency.WithPolicy(concurrency.PolicyBlock))
+	}()
+	close(gate)
+	if err := <-blocked; err != nil {
+		t.Error(err)
+	}
+	for _, expected := range []string{"newest", "blocked"} {
+		if out := <-output; out != expected {
+			t.Errorf("expected %s, got %v", expected, out)
+		}
+	}
+}
+
+func TestWorkersPoolElastic(t *testing.T) {
+	wp := concurrency.WorkersPool{
+		Elastic: &concurrency.ElasticConfig{
+			MinWorkers:     1,
+			MaxWorkers:     4,
+			QueueThreshold: 2,
+			KeepAlive:      50 * time.Millisecond,
+		},
+	}
+	wp.Start(1, 100)
+	defer wp.Stop()
+
+	gate := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		wp.Collect(func(interface{}) interface{} {
+			<-gate
+			return nil
+		}, nil, 0)
+	}
+	if n := wp.Workers(); n != 4 {
+		t.Errorf("expected pool to grow to 4 workers, got %d", n)
+	}
+	close(gate)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for wp.Workers() > 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := wp.Workers(); n != 1 {
+		t.Errorf("expected idle workers to retire, got %d", n)
+	}
+
+	if err := wp.Resize(3); err != nil {
+		t.Error(err)
+	}
+	if err := wp.Resize(5); err == nil {
+		t.Error("expected resize beyond MaxWorkers to fail")
+	}
+}
+
+func TestWorkersPoolResize(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(2, 100)
+	defer wp.Stop()
+
+	if err := wp.Resize(5); err != nil {
+		t.Fatal(err)
+	}
+	if n := wp.Workers(); n != 5 {
+		t.Errorf("expected 5 workers, got %d", n)
+	}
+	if err := wp.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+	output := make(chan interface{}, 1)
+	wp.CollectWithOutput(func(p interface{}) interface{} { return p }, 1, 0, output)
+	if out := <-output; out != 1 {
+		t.Errorf("unexpected output %v", out)
+	}
+}
+
+func TestWorkersPoolResizeWithBacklog(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(4, 100)
+	defer wp.Stop()
+
+	var running, peak int64
+	gate := make(chan struct{})
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		wp.Collect(func(interface{}) interface{} {
+			defer wg.Done()
+			n := atomic.AddInt64(&running, 1)
+			<-gate
+			for p := atomic.LoadInt64(&peak); n > p && !atomic.CompareAndSwapInt64(&peak, p, n); p = atomic.LoadInt64(&peak) {
+			}
+			time.Sleep(2 * time.Millisecond)
+			atomic.AddInt64(&running, -1)
+			return nil
+		}, nil, 0)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := wp.Resize(1); err != nil {
+		t.Fatal(err)
+	}
+	// The four running jobs finish, then only one worker is left.
+	close(gate)
+	time.Sleep(5 * time.Millisecond)
+	atomic.StoreInt64(&peak, 0)
+	wg.Wait()
+	if peak > 1 {
+		t.Errorf("expected one job at a time after shrinking, got %d", peak)
+	}
+}
+
+type countingObserver struct {
+	queued, started, finished, cancelled int64
+}
+
+func (o *countingObserver) WorkQueued(string) {
+	atomic.AddInt64(&o.queued, 1)
+}
+
+func (o *countingObserver) WorkStarted(int, string, time.Duration) {
+	atomic.AddInt64(&o.started, 1)
+}
+
+func (o *countingObserver) WorkFinished(int, string, time.Duration, error) {
+	atomic.AddInt64(&o.finished, 1)
+}
+
+func (o *countingObserver) WorkCancelled(string, error) {
+	atomic.AddInt64(&o.cancelled, 1)
+}
+
+func TestWorkersPoolStats(t *testing.T) {
+	observer := &countingObserver{}
+	wp := concurrency.WorkersPool{Observer: observer}
+	wp.Start(1, 100)
+
+	ctx := context.Background()
+	gate := make(chan struct{})
+	started := make(chan struct{})
+	wp.Collect(func(interface{}) interface{} {
+		close(started)
+		<-gate
+		return nil
+	}, nil, 0)
+	<-started
+	cancelled, cancel := context.WithCancel(ctx)
+	wp.CollectWithContext(cancelled, func(interface{}) interface{} {
+		return nil
+	}, nil, 0)
+	cancel()
+	for i := 0; i < 4; i++ {
+		wp.Collect(func(interface{}) interface{} {
+			time.Sleep(time.Millisecond)
+			return nil
+		}, nil, 0)
+	}
+	concurrency.Submit(&wp, ctx, func(context.Context) (int, error) {
+		return 0, fmt.Errorf("failed")
+	})
+
+	stats := wp.Stats()
+	if len(stats.Workers) != 1 || stats.Workers[0].Status != concurrency.WorkerStateBusy {
+		t.Errorf("expected a single busy worker, got %+v", stats.Workers)
+	}
+	if stats.Queued != 6 {
+		t.Errorf("expected 6 queued works, got %d", stats.Queued)
+	}
+	close(gate)
+	wp.Shutdown(ctx)
+
+	stats = wp.Stats()
+	if stats.Completed != 5 || stats.Failed != 1 || stats.Cancelled != 1 || stats.Running != 0 || stats.Queued != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats.RunTime.Count != 6 || stats.QueueWait.Count != 6 {
+		t.Errorf("expected 6 observations, got %d run and %d wait", stats.RunTime.Count, stats.QueueWait.Count)
+	}
+	if observer.queued != 7 || observer.started != 6 || observer.finished != 6 || observer.cancelled != 1 {
+		t.Errorf("unexpected observer counts %+v", observer)
+	}
+}
+
+func TestWorkersPoolStopWithSchedule(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		wp := concurrency.WorkersPool{}
+		wp.Start(1, 100)
+		ctx := context.Background()
+		slow := func(context.Context) (int, error) {
+			time.Sleep(time.Millisecond)
+			return 0, nil
+		}
+		futures := []*concurrency.Future[int]{}
+		for i := 0; i < 20; i++ {
+			f, err := concurrency.Submit(&wp, ctx, slow, concurrency.RunAfter(time.Duration(i%4)*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			futures = append(futures, f)
+		}
+		time.Sleep(time.Duration(round%4) * time.Millisecond)
+		wp.Stop()
+
+		for i, f := range futures {
+			select {
+			case <-f.Done():
+			case <-time.After(time.Second):
+				t.Fatalf("round %d: future %d never resolved after Stop", round, i)
+			}
+		}
+		shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+		if _, err := wp.Shutdown(shutdownCtx); err != nil {
+			t.Fatalf("round %d: expected nothing left pending after Stop, got %v", round, err)
+		}
+		cancel()
+	}
+}
+
+func TestWorkersPoolSchedule(t *testing.T) {
+	wp := concurrency.WorkersPool{}
+	wp.Start(1, 10)
+	defer wp.Stop()
+
+	ctx := context.Background()
+	output := make(chan interface{}, 10)
+	identity := func(p interface{}) interface{} { return p }
+	begin := time.Now()
+	if _, err := wp.ScheduleAfter(ctx, 80*time.Millisecond, identity, "later", output); err != nil {
+		t.Fatal(err)
+	}
+	cancelled, err := wp.ScheduleAt(ctx, begin.Add(40*time.Millisecond), identity, "cancelled", output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wp.CollectWithOutput(identity, "delayed", 20*time.Millisecond, output)
+	wp.CollectWithOutput(identity, "now", 0, output)
+
+	if !cancelled.Cancel() {
+		t.Error("expected pending work to be cancelled")
+	}
+	if cancelled.Cancel() {
+		t.Error("expected second cancel to fail")
+	}
+
+	for _, expected := range []string{"now", "delayed", "later"} {
+		if out := <-output; out != expected {
+			t.Errorf("expected %s, got %v", expected, out)
+		}
+	}
+	if elapsed := time.Since(begin); elapsed < 80*time.Millisecond {
+		t.Errorf("scheduled work ran too early, after %s", elapsed)
+	}
+	if stats := wp.Stats(); stats.Cancelled != 1 {
+		t.Errorf("expected 1 cancelled work, got %+v", stats)
+	}
+
+	due, err := wp.ScheduleAfter(ctx, 0, identity, "due", output)
+	if err != nil || due == nil {
+		t.Fatalf("expected a handle for due work, got %v", err)
+	}
+	if due.Cancel() || due.At().IsZero() {
+		t.Error("expected due work not to be cancellable")
+	}
+	if out := <-output; out != "due" {
+		t.Errorf("expected due, got %v", out)
+	}
+
+	f, _ := concurrency.Submit(&wp, ctx, func(context.Context) (time.Time, error) {
+		return time.Now(), nil
+	}, concurrency.RunAfter(30*time.Millisecond))
+	submitted := time.Now()
+	if ran, _ := f.Wait(ctx); ran.Sub(submitted) < 25*time.Millisecond {
+		t.Errorf("future ran too early")
+	}
+
+	wp.ScheduleAfter(ctx, time.Hour, identity, "never", output)
+	report, err := wp.Shutdown(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+	if report.Cancelled != 2 {
+		t.Errorf("expected shutdown to cancel the pending schedule, got %+v", report)
+	}
+}
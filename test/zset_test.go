@@ -0,0 +1,109 @@
+package test
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/heqzha/goutils/container"
+)
+
+func TestSortedSet(t *testing.T) {
+	z := container.NewSortedSet()
+	if !z.Set("b", 2) || !z.Set("a", 1) || !z.Set("c", 3) || !z.Set("bb", 2) {
+		t.Fatal("expected new members to be added")
+	}
+	if z.Set("c", 5) {
+		t.Error("expected moving a member not to count as new")
+	}
+	if score := z.Incr("a", 10); score != 11 {
+		t.Errorf("expected 11, got %d", score)
+	}
+	z.Incr("d", 4)
+
+	// Ascending: b:2 bb:2 d:4 c:5 a:11
+	if got := fmt.Sprint(z.Range(1, 2)); got != "[{bb 2} {d 4}]" {
+		t.Errorf("unexpected range %s", got)
+	}
+	if got := fmt.Sprint(z.RevRange(0, 2)); got != "[{a 11} {c 5}]" {
+		t.Errorf("unexpected reverse range %s", got)
+	}
+	if got := fmt.Sprint(z.RangeByRank(-2, -1)); got != "[{c 5} {a 11}]" {
+		t.Errorf("unexpected rank range %s", got)
+	}
+	if rank, _ := z.Rank("d"); rank != 2 {
+		t.Errorf("expected rank 2, got %d", rank)
+	}
+	if rank, _ := z.RevRank("b"); rank != 4 {
+		t.Errorf("expected reverse rank 4, got %d", rank)
+	}
+
+	// Zrangebyscore excludes min.
+	r := container.ScoreRange{Min: 2, Max: 5, MinExclusive: true}
+	if got := fmt.Sprint(z.RangeByScore(r, 0, -1)); got != "[{d 4} {c 5}]" {
+		t.Errorf("unexpected score range %s", got)
+	}
+	if got := fmt.Sprint(z.RevRangeByScore(container.AllScores, 1, 2)); got != "[{c 5} {d 4}]" {
+		t.Errorf("unexpected reverse score range %s", got)
+	}
+	if n := z.Count(r); n != 2 {
+		t.Errorf("expected 2, got %d", n)
+	}
+	if n := z.RemoveRangeByRank(0, 1); n != 2 || z.Exists("b") || z.Len() != 3 {
+		t.Errorf("expected the two lowest to be removed, removed %d", n)
+	}
+	if n := z.RemoveRangeByScore(container.ScoreRange{Min: 5, Max: 100}); n != 2 || z.Len() != 1 {
+		t.Errorf("expected two removed, got %d", n)
+	}
+	if !z.Delete("d") || z.Delete("d") || z.Len() != 0 {
+		t.Error("expected delete to succeed once")
+	}
+}
+
+func TestSortedSetRandom(t *testing.T) {
+	z := container.NewSortedSet()
+	scores := map[string]int64{}
+	for i := 0; i < 2000; i++ {
+		member := fmt.Sprintf("m%d", rand.Intn(300))
+		switch rand.Intn(4) {
+		case 0:
+			z.Delete(member)
+			delete(scores, member)
+		case 1:
+			scores[member] = z.Incr(member, int64(rand.Intn(20)-10))
+		default:
+			score := int64(rand.Intn(50))
+			z.Set(member, score)
+			scores[member] = score
+		}
+	}
+	expected := []container.ZMember{}
+	for member, score := range scores {
+		expected = append(expected, container.ZMember{Member: member, Score: score})
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		if expected[i].Score == expected[j].Score {
+			return expected[i].Member < expected[j].Member
+		}
+		return expected[i].Score < expected[j].Score
+	})
+	if got := z.RangeByRank(0, -1); fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("order diverged from a sorted map")
+	}
+	for i, m := range expected {
+		if rank, ok := z.Rank(m.Member); !ok || rank != i {
+			t.Fatalf("expected %s at %d, got %d", m.Member, i, rank)
+		}
+	}
+	r := container.ScoreRange{Min: 10, Max: 30, MaxExclusive: true}
+	n := 0
+	for _, m := range expected {
+		if m.Score >= 10 && m.Score < 30 {
+			n++
+		}
+	}
+	if z.Count(r) != n || len(z.RangeByScore(r, 0, -1)) != n {
+		t.Errorf("expected %d members in range, got %d", n, z.Count(r))
+	}
+}